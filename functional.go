@@ -3,8 +3,23 @@
 package functional
 
 import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"container/list"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand"
 	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // Type I is the type of the element of a Pair. It is defined as interface{},
@@ -22,15 +37,37 @@ type Pair struct {
 	Tail *Thunk
 }
 
-// A Thunk is a delayed Pair. It is a function that, when called, 
-// returns or generates the underlying pair. In practice, Thunk is like a Pair 
-// which is like a List; you won't usually need to worry about the differences.
-// Use MakeThunk to provide your own generator function.
-type Thunk func() *Pair
+// A Thunk is a delayed Pair. It holds a function that, when called,
+// returns or generates the underlying pair, and, once forced with
+// memoization on, the pair itself, so that the function isn't called again.
+// In practice, Thunk is like a Pair which is like a List; you won't usually
+// need to worry about the differences. Use MakeThunk to provide your own
+// generator function.
+type Thunk struct {
+	mu     sync.Mutex
+	gen    func() *Pair
+	pair   *Pair
+	forced bool
+	mode   memoMode
+}
+
+// Whether a Thunk memoizes its pair when forced.
+type memoMode int8
+
+const (
+	memoGlobal memoMode = iota // As set by StartMemo and StopMemo.
+	memoAlways
+	memoNever
+)
 
 func MakeThunk(f func() *Pair) *Thunk {
-	var ret Thunk = f
-	return &ret
+	return &Thunk{gen: f}
+}
+
+// Makes a Thunk whose generator runs only once, even if memoization is
+// off. Needed by generators that have side effects or update some state.
+func makeOnceThunk(f func() *Pair) *Thunk {
+	return &Thunk{gen: f, mode: memoAlways}
 }
 
 // Empty is the empty Thunk, that is, a Thunk that returns nil. Lists end
@@ -39,29 +76,89 @@ var Empty *Thunk
 
 var memo bool
 
+// Guards memo, so it can be switched while lists are being forced.
+var memoMu sync.RWMutex
+
 // Starts memoizing thunk evaluations. By default memoization is on.
 func StartMemo() {
+	memoMu.Lock()
 	memo = true
+	memoMu.Unlock()
 }
 
 // Stops memoizing thunk evaluations. By default memoization is on.
 func StopMemo() {
+	memoMu.Lock()
 	memo = false
+	memoMu.Unlock()
+}
+
+func memoizing() bool {
+	memoMu.RLock()
+	defer memoMu.RUnlock()
+	return memo
 }
 
+// Each thunk is locked while forced, so that it can be forced from several
+// goroutines at once and, with memoization on, its generator runs once.
 func force(thunk *Thunk) *Pair {
 	if thunk == nil {
 		return nil
 	}
-	pair := (*thunk)()
-	if memo {
-		*thunk = *MakeThunk(func() *Pair {
-			return pair
-		})
+	thunk.mu.Lock()
+	defer thunk.mu.Unlock()
+	if thunk.forced {
+		return thunk.pair
+	}
+	pair := thunk.gen()
+	if thunk.mode == memoAlways || thunk.mode == memoGlobal && memoizing() {
+		thunk.pair, thunk.forced, thunk.gen = pair, true, nil
 	}
 	return pair
 }
 
+// Makes thunk generate the same list as other, for decoders that must fill
+// an existing Thunk. Lists are shared, so only a zero Thunk, which is what
+// decoders allocate for a nil *Thunk, can be filled; it fails for any
+// other, leaving it untouched.
+func (thunk *Thunk) become(other *Thunk) error {
+	thunk.mu.Lock()
+	defer thunk.mu.Unlock()
+	if thunk.gen != nil || thunk.forced {
+		return errors.New("functional: can only decode into a new Thunk, not an existing list")
+	}
+	thunk.gen = func() *Pair { return force(other) }
+	return nil
+}
+
+// Makes a view of a list whose thunks memoize their pairs, or don't, as
+// set by on, whatever the global setting is. Only the view's own thunks
+// are affected: forcing the view with memoization off forces the original
+// list again, which may in turn have memoized its pairs. To make sure a
+// generator runs just once, take a memoizing view (or use Cache) and force
+// only that.
+func (thunk *Thunk) WithMemo(on bool) *Thunk {
+	mode := memoNever
+	if on {
+		mode = memoAlways
+	}
+	return &Thunk{gen: func() *Pair {
+		pair := force(thunk)
+		if pair == nil {
+			return nil
+		}
+		return &Pair{pair.Head, pair.Tail.WithMemo(on)}
+	}, mode: mode}
+}
+
+// Makes a view of a list that keeps every pair once it is forced, even if
+// memoization is off, so each element of the list is produced only once
+// however many times the view is traversed. It is the same as
+// WithMemo(true).
+func (thunk *Thunk) Cache() *Thunk {
+	return thunk.WithMemo(true)
+}
+
 func (thunk *Thunk) Head() I {
 	return force(thunk).Head
 }
@@ -70,6 +167,32 @@ func (thunk *Thunk) Tail() *Thunk {
 	return force(thunk).Tail
 }
 
+// Tests if a list is empty. Only its first element is forced, so it works
+// on infinite lists, unlike checking Length.
+func (thunk *Thunk) IsEmpty() bool {
+	return force(thunk) == nil
+}
+
+// Retrieves the first element of a list. Unlike Head, it doesn't panic on
+// an empty list, but returns ok as false.
+func (thunk *Thunk) HeadSafe() (x I, ok bool) {
+	pair := force(thunk)
+	if pair == nil {
+		return nil, false
+	}
+	return pair.Head, true
+}
+
+// Retrieves a list without its first element. Unlike Tail, it doesn't panic
+// on an empty list, but returns ok as false.
+func (thunk *Thunk) TailSafe() (tail *Thunk, ok bool) {
+	pair := force(thunk)
+	if pair == nil {
+		return nil, false
+	}
+	return pair.Tail, true
+}
+
 // Takes a head element and a tail Thunk and makes a Thunk with them.
 // Similar to Lisp's `cons` or Haskell's `(:)`.
 // 	list123 := Link(1, Link(2, Link(3, Empty)))
@@ -100,10 +223,11 @@ func DelayedLink(head I, tail func() *Thunk) *Thunk {
 // Helper function that Links all its arguments. You can easily make a list
 // from a slice with it: List(slice...)
 func List(items ...I) *Thunk {
-	if len(items) >= 1 {
-		return Link(items[0], List(items[1:]...))
+	ret := Empty
+	for i := len(items) - 1; i >= 0; i-- {
+		ret = Link(items[i], ret)
 	}
-	return Empty
+	return ret
 }
 
 // Shortcut for List.
@@ -111,9 +235,10 @@ func L(items ...I) *Thunk {
 	return List(items...)
 }
 
+// Makes a List from a slice or an array. It returns nil for anything else.
 func SliceToList(items I) (ret *Thunk) {
 	t := reflect.TypeOf(items)
-	if items == nil || t.Kind() != reflect.Slice {
+	if items == nil || t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
 		return
 	}
 	v := reflect.ValueOf(items)
@@ -124,6 +249,34 @@ func SliceToList(items I) (ret *Thunk) {
 	return
 }
 
+// Like SliceToList, but fails if items isn't a slice or an array instead
+// of returning nil, so a bad argument can be told apart from an empty slice.
+func SliceToListChecked(items I) (*Thunk, error) {
+	if items == nil {
+		return nil, errors.New("functional: cannot make a list from nil")
+	}
+	if t := reflect.TypeOf(items); t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+		return nil, fmt.Errorf("functional: cannot make a list from %T, not a slice or array", items)
+	}
+	return SliceToList(items), nil
+}
+
+// Makes a list of two-element lists, key and value, from the entries of a
+// map. The order of the entries is unspecified. It returns nil if items
+// isn't a map, like SliceToList does for non-slices.
+//	FromMap(map[string]int{"a": 1}) // L(L("a", 1))
+func FromMap(m I) (ret *Thunk) {
+	t := reflect.TypeOf(m)
+	if m == nil || t.Kind() != reflect.Map {
+		return
+	}
+	ret = Empty
+	for iter := reflect.ValueOf(m).MapRange(); iter.Next(); {
+		ret = Link(L(iter.Key().Interface(), iter.Value().Interface()), ret)
+	}
+	return
+}
+
 // Makes a slice from a List.
 func (thunk *Thunk) ToSlice() [](I) {
 	ret := make([]I, thunk.Length())
@@ -135,21 +288,23 @@ func (thunk *Thunk) ToSlice() [](I) {
 	return ret
 }
 
-// Makes a single List by appending one to another.
+// Makes a single List by appending one to another. Once the first list
+// ends, the result continues with the pairs of the second one as they are,
+// so traversing it takes linear time whether memoization is on or not.
 func (thunk *Thunk) Append(other *Thunk) *Thunk {
 	return MakeThunk(func() *Pair {
 		pair := force(thunk)
-		if pair != nil {
-			return &Pair{pair.Head, pair.Tail.Append(other)}
-		} else if pair := force(other); pair != nil {
-			return &Pair{pair.Head, pair.Tail.Append(Empty)}
+		if pair == nil {
+			return force(other)
 		}
-		return nil
+		return &Pair{pair.Head, pair.Tail.Append(other)}
 	})
 }
 
 // A handy way of iterating through a List is by calling Iter()
-// in a for-range loop.
+// in a for-range loop. The goroutine feeding the channel only ends when
+// the list does, so breaking out of the loop early leaks it; use
+// IterContext in that case.
 func (thunk *Thunk) Iter() chan I {
 	ch := make(chan I)
 	go func() {
@@ -167,6 +322,44 @@ func (thunk *Thunk) Iter() chan I {
 	return ch
 }
 
+// Performs just like Iter, but the goroutine feeding the channel stops,
+// closing it, as soon as ctx is done, so that the caller can stop
+// iterating at any point without leaking it.
+//	ctx, cancel := context.WithCancel(context.Background())
+//	defer cancel()
+//	for x := range prog.IterContext(ctx) {
+//		if x.(int) > 10 {
+//			break
+//		}
+//	}
+func (thunk *Thunk) IterContext(ctx context.Context) <-chan I {
+	ch := make(chan I)
+	go func() {
+		defer close(ch)
+		for pair := force(thunk); pair != nil; pair = force(pair.Tail) {
+			select {
+			case ch <- pair.Head:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// Calls f on each element of a list, in order, until the list ends or f
+// returns false. Unlike Iter, it doesn't need a goroutine, so stopping
+// early leaks nothing, and it works on infinite lists as long as f
+// eventually returns false.
+//	prog.ForEach(func(x I) bool {
+//		fmt.Println(x)
+//		return x.(int) < 10
+//	})
+func (thunk *Thunk) ForEach(f func(I) bool) {
+	for pair := force(thunk); pair != nil && f(pair.Head); pair = force(pair.Tail) {
+	}
+}
+
 func (thunk *Thunk) String() (ret string) {
 	ret = "["
 	first := true
@@ -229,20 +422,46 @@ func (thunk *Thunk) Length() (ret int) {
 	return
 }
 
+// Forces every pair of a finite list and discards the elements. Useful to
+// consume lists built from effectful sources, such as FromChan or
+// FromReaderLines, just for their side effects.
+func (thunk *Thunk) Drain() {
+	for pair := force(thunk); pair != nil; pair = force(pair.Tail) {
+	}
+}
+
+// Counts the elements of a list, but stops after max of them, so it is
+// safe on infinite lists. completed is false if the list has more than
+// max elements, in which case count is max.
+func (thunk *Thunk) LengthAtMost(max uint) (count uint, completed bool) {
+	for pair := force(thunk); pair != nil; pair = force(pair.Tail) {
+		if count == max {
+			return max, false
+		}
+		count++
+	}
+	return count, true
+}
+
+// ErrIndexOutOfRange is returned by At when the list is too short to have
+// an element at the requested position.
+var ErrIndexOutOfRange = errors.New("functional: index out of range")
+
 // Retrieves the element at the n-th position on the list. If there is
-// no such element, err is set.
-func (thunk *Thunk) At(n uint) (ret I) {
+// no such element, err is ErrIndexOutOfRange.
+//
+// At used to return just the element and panic on a short list; callers
+// must now check (or explicitly ignore) the error.
+func (thunk *Thunk) At(n uint) (ret I, err error) {
 	var pair *Pair
 	for i := uint(0); i <= n; i++ {
 		pair = force(thunk)
 		if pair == nil {
-			panic("Index out of list.")
-			return
+			return nil, ErrIndexOutOfRange
 		}
 		thunk = pair.Tail
 	}
-	ret = pair.Head
-	return
+	return pair.Head, nil
 }
 
 // Takes the first n elements of a list. Mostly needed for infinite lists.
@@ -260,20 +479,13 @@ func (thunk *Thunk) Take(n uint) *Thunk {
 
 // Drops the first n elements of a list and returns the rest.
 func (thunk *Thunk) Drop(n uint) *Thunk {
-	var f func() *Pair
-	f = func() *Pair {
+	return MakeThunk(func() *Pair {
 		pair := force(thunk)
-		if pair != nil {
-			if n > 0 {
-				n -= 1
-				thunk = pair.Tail
-				return f()
-			}
-			return pair
+		for i := n; pair != nil && i > 0; i-- {
+			pair = force(pair.Tail)
 		}
-		return nil
-	}
-	return MakeThunk(f)
+		return pair
+	})
 }
 
 // Applies a function to each element of some lists. The function must
@@ -440,8 +652,30 @@ func (thunk *Thunk) Has(x I) bool {
 	})
 }
 
+// Tests if a list begins with the elements of a finite prefix, compared
+// with reflect.DeepEqual. Only as many elements as the prefix has are
+// forced, so the list may be infinite. An empty prefix is always matched.
+//	prog.StartsWith(L(1, 2, 3)) // true
+func (thunk *Thunk) StartsWith(prefix *Thunk) bool {
+	pair := force(thunk)
+	for p := force(prefix); p != nil; p = force(p.Tail) {
+		if pair == nil || !reflect.DeepEqual(pair.Head, p.Head) {
+			return false
+		}
+		pair = force(pair.Tail)
+	}
+	return true
+}
+
+// Tests if a finite list ends with the elements of a finite suffix,
+// compared with reflect.DeepEqual. An empty suffix is always matched.
+func (thunk *Thunk) EndsWith(suffix *Thunk) bool {
+	n, m := suffix.Length(), thunk.Length()
+	return m >= n && thunk.Drop(uint(m-n)).StartsWith(suffix)
+}
+
 // Retrieves the maximum element of a list. Obviously, the list must be
-// composed of ordered elements (ints, floats or strings).
+// composed of ordered elements (ints, uints, floats or strings).
 func (thunk *Thunk) Max() I {
 	return thunk.Reduce(func(acc, x I) I {
 		accV := reflect.ValueOf(acc)
@@ -456,7 +690,7 @@ func (thunk *Thunk) Max() I {
 			} else {
 				return x
 			}
-		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 			if accV.Uint() >= xV.Uint() {
 				return acc
 			} else {
@@ -470,7 +704,7 @@ func (thunk *Thunk) Max() I {
 				return x
 			}
 		case reflect.String:
-			if accV.Float() >= xV.Float() {
+			if accV.String() >= xV.String() {
 				return acc
 			} else {
 				return x
@@ -481,7 +715,7 @@ func (thunk *Thunk) Max() I {
 }
 
 // Retrieves the minimum element of a list. Obviously, the list must be
-// composed of ordered elements (ints, floats or strings).
+// composed of ordered elements (ints, uints, floats or strings).
 func (thunk *Thunk) Min() I {
 	return thunk.Reduce(func(acc, x I) I {
 		accV := reflect.ValueOf(acc)
@@ -496,7 +730,7 @@ func (thunk *Thunk) Min() I {
 			} else {
 				return x
 			}
-		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 			if accV.Uint() <= xV.Uint() {
 				return acc
 			} else {
@@ -510,7 +744,7 @@ func (thunk *Thunk) Min() I {
 				return x
 			}
 		case reflect.String:
-			if accV.Float() <= xV.Float() {
+			if accV.String() <= xV.String() {
 				return acc
 			} else {
 				return x
@@ -534,16 +768,13 @@ func (thunk *Thunk) TakeWhile(f func(I) bool) *Thunk {
 // Lists the elements of the list after the first one that doesn't pass a 
 // filtering function.
 func (thunk *Thunk) DropWhile(f func(I) bool) *Thunk {
-	var g func() *Pair
-	g = func() *Pair {
+	return MakeThunk(func() *Pair {
 		pair := force(thunk)
-		if pair != nil && f(pair.Head) {
-			thunk = pair.Tail
-			return g()
+		for pair != nil && f(pair.Head) {
+			pair = force(pair.Tail)
 		}
 		return pair
-	}
-	return MakeThunk(g)
+	})
 }
 
 // Takes some lists and returns a list with slices of one element of each list.
@@ -578,22 +809,45 @@ func (thunk *Thunk) Flatten() *Thunk {
 	}, L()).(*Thunk)*/
 }
 
+// Lists the elements of a list in reverse order. The whole list is
+// traversed when the result is first forced, so it never ends for an
+// infinite list. The reversal is done once and kept, even if memoization
+// is off.
 func (thunk *Thunk) Reverse() *Thunk {
-	return MakeThunk(func() *Pair {
-		return force(thunk.Reduce(func(acc, x I) I {
-			return Link(x, acc.(*Thunk))
-		}, L()).(*Thunk))
+	return makeOnceThunk(func() *Pair {
+		ret := Empty
+		for pair := force(thunk); pair != nil; pair = force(pair.Tail) {
+			ret = Link(pair.Head, ret)
+		}
+		return force(ret)
+	})
+}
+
+// Lists the elements of a finite list in a random order, taken from r, so
+// the same seed gives the same order. As with Sort, the whole list is
+// traversed and shuffled right away, so the order only depends on the
+// order of the calls sharing r.
+func (thunk *Thunk) Shuffle(r *rand.Rand) *Thunk {
+	items := thunk.ToSlice()
+	r.Shuffle(len(items), func(i, j int) {
+		items[i], items[j] = items[j], items[i]
 	})
+	return List(items...)
 }
 
-func (thunk *Thunk) Last() I {
-	pair := force(thunk.Reverse().Take(1))
-	return pair.Head
+// Retrieves the last element of a finite list, or nil if it is empty.
+// Only the current element is kept while traversing the list.
+func (thunk *Thunk) Last() (ret I) {
+	for pair := force(thunk); pair != nil; pair = force(pair.Tail) {
+		ret = pair.Head
+	}
+	return
 }
 
 // Makes an autoupdating infinite list. Each element will be
 // generated by a function that takes the previous element as
-// argument. You must provide an initial element.
+// argument. You must provide an initial element. Also available as
+// Iterate.
 //	naturals := Updating(0, func(x I) I {
 //		return x.(int) + 1
 //	})
@@ -603,6 +857,15 @@ func Updating(initial I, f func(I) I) *Thunk {
 	})
 }
 
+// Same as Updating, with the arguments in the usual order of Haskell's
+// iterate: lists x, f(x), f(f(x)), and so on.
+//	naturals := Iterate(func(x I) I {
+//		return x.(int) + 1
+//	}, 0)
+func Iterate(f func(I) I, initial I) *Thunk {
+	return Updating(initial, f)
+}
+
 // Currying is a way of thinking about multiparameter functions
 // not as taking a tuple of values, but as taking a sole parameter
 // and returning a function that takes another parameter and so on.
@@ -648,6 +911,1691 @@ func Curry(f I) F {
 	return ret
 }
 
+// Encodes a finite list with encoding/gob, so it can be cached to disk or
+// sent over the wire. Implements gob.GobEncoder.
+//
+// As elements are of type I, gob needs to know their concrete types: call
+// gob.Register with a value of each type you put in the list (other than
+// the basic ones gob already knows) before encoding or decoding it.
+func (thunk *Thunk) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(thunk.ToSlice()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Fills a new Thunk with the list encoded in data by GobEncode, as gob
+// does for a nil *Thunk. Lists are shared, so it fails on a Thunk that is
+// already a list, such as Empty, instead of changing it. Implements
+// gob.GobDecoder.
+func (thunk *Thunk) GobDecode(data []byte) error {
+	list, err := FromGob(data)
+	if err != nil {
+		return err
+	}
+	return thunk.become(list)
+}
+
+// Makes a list from data encoded by GobEncode. The same types must have
+// been registered with gob.Register as when encoding.
+func FromGob(data []byte) (*Thunk, error) {
+	var items []I
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&items); err != nil {
+		return nil, err
+	}
+	return SliceToList(items), nil
+}
+
+// Forces a list once and copies it into an independent, already evaluated
+// list, which is returned along with its length. Operations on the snapshot
+// won't run the original generators again. The list must be finite.
+func (thunk *Thunk) Materialize() (snapshot *Thunk, length int) {
+	items := thunk.ToSlice()
+	snapshot = Empty
+	for i := len(items) - 1; i >= 0; i-- {
+		pair := &Pair{items[i], snapshot}
+		snapshot = MakeThunk(func() *Pair { return pair })
+	}
+	return snapshot, len(items)
+}
+
+// Lists, for each position, how many distinct elements (according to
+// reflect.DeepEqual) have been seen up to and including it.
+//	L(1, 2, 1, 3).CumDistinct() // L(1, 2, 2, 3)
+// It works on infinite lists, but remembers every distinct element seen
+// so far, so memory grows with their number.
+func (thunk *Thunk) CumDistinct() *Thunk {
+	var cum func(*Thunk, []I) *Thunk
+	cum = func(thunk *Thunk, seen []I) *Thunk {
+		return MakeThunk(func() *Pair {
+			pair := force(thunk)
+			if pair == nil {
+				return nil
+			}
+			for _, x := range seen {
+				if reflect.DeepEqual(x, pair.Head) {
+					return &Pair{len(seen), cum(pair.Tail, seen)}
+				}
+			}
+			seen := append(seen[:len(seen):len(seen)], pair.Head)
+			return &Pair{len(seen), cum(pair.Tail, seen)}
+		})
+	}
+	return cum(thunk, nil)
+}
+
+// Combines the elements of three lists with a typed function, stopping when
+// any of the lists ends. The elements are type-asserted to the function's
+// argument types, so it panics on elements of other types.
+//	ZipWith3(L(1, 2), L("a", "b"), L(true, false),
+//		func(n int, s string, b bool) string {
+//			return fmt.Sprint(n, s, b)
+//		}) // L("1atrue", "2bfalse")
+func ZipWith3[A, B, C, R any](a, b, c *Thunk, f func(A, B, C) R) *Thunk {
+	return MapN(func(xs ...I) I {
+		return f(xs[0].(A), xs[1].(B), xs[2].(C))
+	}, a, b, c)
+}
+
+// Splits a list into its head and the rest of its elements as a slice.
+// ok is false if the list is empty. The list must be finite.
+func (thunk *Thunk) Decompose() (head I, tail []I, ok bool) {
+	pair := force(thunk)
+	if pair == nil {
+		return nil, nil, false
+	}
+	return pair.Head, pair.Tail.ToSlice(), true
+}
+
+// Performs just like Filter, but remembers the result of the testing
+// function for each distinct element (according to reflect.DeepEqual), so
+// it is called only once per value. Useful for costly testing functions on
+// lists with many repeated elements. Every distinct element seen is kept
+// in memory, and looked up linearly. The cache is shared by every
+// goroutine forcing the list, and f is called with its lock held.
+func (thunk *Thunk) FilterMemo(f func(I) bool) *Thunk {
+	type result struct {
+		x    I
+		pass bool
+	}
+	var mu sync.Mutex
+	var cache []result
+	test := func(x I) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, r := range cache {
+			if reflect.DeepEqual(r.x, x) {
+				return r.pass
+			}
+		}
+		pass := f(x)
+		cache = append(cache, result{x, pass})
+		return pass
+	}
+	return thunk.Filter(test)
+}
+
+type mergeItem struct {
+	head  I
+	tail  *Thunk
+	index int
+}
+
+type mergeHeap struct {
+	items []mergeItem
+	less  func(a, b I) bool
+}
+
+func (h *mergeHeap) Len() int { return len(h.items) }
+
+func (h *mergeHeap) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	if h.less(a.head, b.head) {
+		return true
+	}
+	return !h.less(b.head, a.head) && a.index < b.index
+}
+
+func (h *mergeHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *mergeHeap) Push(x interface{}) { h.items = append(h.items, x.(mergeItem)) }
+
+func (h *mergeHeap) Pop() interface{} {
+	item := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return item
+}
+
+// Merges some lists, each sorted according to less, into a single sorted
+// list. Equal elements keep the order of the lists they come from. It works
+// on infinite lists.
+//	MergeN(intLess, L(1, 4), L(2, 3, 5), L(0)) // L(0, 1, 2, 3, 4, 5)
+func MergeN(less func(a, b I) bool, thunks ...*Thunk) *Thunk {
+	var h *mergeHeap
+	var next func() *Pair
+	next = func() *Pair {
+		if h == nil {
+			h = &mergeHeap{less: less}
+			for k, thunk := range thunks {
+				if pair := force(thunk); pair != nil {
+					h.items = append(h.items, mergeItem{pair.Head, pair.Tail, k})
+				}
+			}
+			heap.Init(h)
+		}
+		if h.Len() == 0 {
+			return nil
+		}
+		item := heap.Pop(h).(mergeItem)
+		if pair := force(item.tail); pair != nil {
+			heap.Push(h, mergeItem{pair.Head, pair.Tail, item.index})
+		}
+		return &Pair{item.head, makeOnceThunk(next)}
+	}
+	return makeOnceThunk(next)
+}
+
+// Applies a function n times to x, that is, returns f(f(...f(x))). It is the
+// strict counterpart of Updating: ApplyN(n, f, x) is the element Updating(x, f).At(n)
+// returns, without building the list.
+func ApplyN(n uint, f func(I) I, x I) I {
+	for ; n > 0; n-- {
+		x = f(x)
+	}
+	return x
+}
+
+// Converts a numeric value (an int, uint or float of any size) to float64.
+func toFloat(x I) (float64, bool) {
+	v := reflect.ValueOf(x)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// Computes the minimum, maximum, mean and count of the elements of a finite
+// list of numbers in a single traversal. ok is false if the list is empty or
+// has any non-numeric element.
+func (thunk *Thunk) Stats() (min, max, mean float64, count int, ok bool) {
+	var sum float64
+	for pair := force(thunk); pair != nil; pair = force(pair.Tail) {
+		x, isNum := toFloat(pair.Head)
+		if !isNum {
+			return 0, 0, 0, 0, false
+		}
+		if count == 0 || x < min {
+			min = x
+		}
+		if count == 0 || x > max {
+			max = x
+		}
+		sum += x
+		count++
+	}
+	if count == 0 {
+		return 0, 0, 0, 0, false
+	}
+	return min, max, sum / float64(count), count, true
+}
+
+// Performs just like TakeWhile, but the filtering function also gets the
+// position of each element.
+//	prog.TakeWhileIndexed(func(i int, x I) bool {
+//		return x.(int) > i
+//	})
+func (thunk *Thunk) TakeWhileIndexed(f func(int, I) bool) *Thunk {
+	var take func(*Thunk, int) *Thunk
+	take = func(thunk *Thunk, i int) *Thunk {
+		return MakeThunk(func() *Pair {
+			pair := force(thunk)
+			if pair != nil && f(i, pair.Head) {
+				return &Pair{pair.Head, take(pair.Tail, i+1)}
+			}
+			return nil
+		})
+	}
+	return take(thunk, 0)
+}
+
+// Lists a (from, to) list for each pair of adjacent elements which are
+// different according to reflect.DeepEqual, skipping runs of equal ones.
+//	L(1, 1, 2, 2, 3, 1).Transitions() // L(L(1, 2), L(2, 3), L(3, 1))
+func (thunk *Thunk) Transitions() *Thunk {
+	return MakeThunk(func() *Pair {
+		pair := force(thunk)
+		if pair == nil {
+			return nil
+		}
+		rest := pair.Tail
+		next := force(rest)
+		for next != nil && reflect.DeepEqual(pair.Head, next.Head) {
+			rest = next.Tail
+			next = force(rest)
+		}
+		if next == nil {
+			return nil
+		}
+		return &Pair{L(pair.Head, next.Head), rest.Transitions()}
+	})
+}
+
+// Writes each element of a finite list to w as JSON, one per line (the
+// format known as NDJSON or JSON Lines). Elements are written as the list
+// is traversed, without holding the whole list in memory. It stops at the
+// first element which can't be marshaled or written, returning the error.
+func (thunk *Thunk) WriteJSONLines(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for pair := force(thunk); pair != nil; pair = force(pair.Tail) {
+		if err := enc.Encode(pair.Head); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Makes a list of the JSON values read from r, one per line, as written by
+// WriteJSONLines. Lines are read and decoded as the list is forced; blank
+// lines are skipped. Numbers are decoded as by FromJSON, but arrays are
+// left as slices. The list ends at EOF. If a line can't be decoded or
+// reading fails, the error is the last element of the list; a read error
+// wraps it and includes the part of the line read before the failure, if
+// any.
+func FromJSONLines(r io.Reader) *Thunk {
+	br := bufio.NewReader(r)
+	var next func() *Pair
+	next = func() *Pair {
+		for {
+			line, err := br.ReadBytes('\n')
+			if err != nil && err != io.EOF {
+				if len(line) > 0 {
+					err = fmt.Errorf("functional: reading JSON line after %q: %w", line, err)
+				}
+				return &Pair{err, Empty}
+			}
+			if len(bytes.TrimSpace(line)) > 0 {
+				var x interface{}
+				if err := decodeJSON(line, &x); err != nil {
+					return &Pair{err, Empty}
+				}
+				return &Pair{fromJSONNumbers(x), makeOnceThunk(next)}
+			}
+			if err == io.EOF {
+				return nil
+			}
+		}
+	}
+	return makeOnceThunk(next)
+}
+
+// Lists the result of applying a function to the elements of each window
+// of size consecutive elements, advancing step elements from one window to
+// the next. Windows shorter than size at the end of the list are skipped.
+// With step equal to size the windows are contiguous chunks; with a smaller
+// step, they overlap. It panics if size or step are 0.
+//	L(1, 2, 3, 4, 5).WindowedReduce(3, 2, sum) // L(6, 12)
+func (thunk *Thunk) WindowedReduce(size, step uint, f func(...I) I) *Thunk {
+	if size == 0 || step == 0 {
+		panic("Window size and step must be positive.")
+	}
+	return MakeThunk(func() *Pair {
+		window := thunk.Take(size).ToSlice()
+		if uint(len(window)) < size {
+			return nil
+		}
+		return &Pair{f(window...), thunk.Drop(step).WindowedReduce(size, step, f)}
+	})
+}
+
+// Lists the elements whose position, modulo modulus, equals remainder. It
+// panics unless remainder < modulus.
+//	prog.SelectModulo(3, 1) // L(2, 5, 8, ...)
+func (thunk *Thunk) SelectModulo(modulus, remainder uint) *Thunk {
+	if remainder >= modulus {
+		panic("Remainder must be less than modulus.")
+	}
+	var every func(*Thunk) *Thunk
+	every = func(thunk *Thunk) *Thunk {
+		return MakeThunk(func() *Pair {
+			pair := force(thunk)
+			if pair == nil {
+				return nil
+			}
+			return &Pair{pair.Head, every(pair.Tail.Drop(modulus - 1))}
+		})
+	}
+	return every(thunk.Drop(remainder))
+}
+
+// Flattens a list of arbitrarily nested lists, listing a (depth, element)
+// list for each element that isn't a list, depth being how many lists
+// deep it was nested.
+//	L(1, L(2, L(3))).FlattenWithDepth() // L(L(0, 1), L(1, 2), L(2, 3))
+func (thunk *Thunk) FlattenWithDepth() *Thunk {
+	var flatten func(thunk *Thunk, depth int, rest *Thunk) *Thunk
+	flatten = func(thunk *Thunk, depth int, rest *Thunk) *Thunk {
+		return MakeThunk(func() *Pair {
+			pair := force(thunk)
+			if pair == nil {
+				return force(rest)
+			}
+			tail := flatten(pair.Tail, depth, rest)
+			if sub, ok := pair.Head.(*Thunk); ok {
+				return force(flatten(sub, depth+1, tail))
+			}
+			return &Pair{L(depth, pair.Head), tail}
+		})
+	}
+	return flatten(thunk, 0, Empty)
+}
+
+// Runs a state machine over a list: for each element, step takes the
+// current state and the element and returns the next state and an output,
+// which is listed. Elements are type-asserted to In, so it panics when it
+// reaches an element of another type.
+func RunStateMachine[S, In, Out any](t *Thunk, init S, step func(S, In) (S, Out)) *Thunk {
+	return MakeThunk(func() *Pair {
+		pair := force(t)
+		if pair == nil {
+			return nil
+		}
+		state, out := step(init, pair.Head.(In))
+		return &Pair{out, RunStateMachine(pair.Tail, state, step)}
+	})
+}
+
+// Collapses each run of at least minRun consecutive equal elements
+// (according to reflect.DeepEqual) into a single one, leaving shorter runs
+// untouched. Useful for debouncing noisy signals.
+//	L(1, 1, 2, 3, 3, 3, 1).SuppressRepeats(3) // L(1, 1, 2, 3, 1)
+func (thunk *Thunk) SuppressRepeats(minRun uint) *Thunk {
+	return MakeThunk(func() *Pair {
+		pair := force(thunk)
+		if pair == nil {
+			return nil
+		}
+		equal := func(x I) bool {
+			return reflect.DeepEqual(pair.Head, x)
+		}
+		n, rest := uint(1), pair.Tail
+		for n < minRun {
+			next := force(rest)
+			if next == nil || !equal(next.Head) {
+				return force(thunk.Take(n).Append(rest.SuppressRepeats(minRun)))
+			}
+			n, rest = n+1, next.Tail
+		}
+		return &Pair{pair.Head, rest.DropWhile(equal).SuppressRepeats(minRun)}
+	})
+}
+
+// Collapses each run of consecutive elements that are equal according to
+// eq into its first element, like Unix uniq. It is lazy, so it works on
+// infinite lists.
+//	L(1, 1, 2, 2, 1).Dedup(intEq) // L(1, 2, 1)
+func (thunk *Thunk) Dedup(eq func(I, I) bool) *Thunk {
+	return MakeThunk(func() *Pair {
+		pair := force(thunk)
+		if pair == nil {
+			return nil
+		}
+		return &Pair{pair.Head, pair.Tail.DropWhile(func(x I) bool {
+			return eq(pair.Head, x)
+		}).Dedup(eq)}
+	})
+}
+
+// Performs just like MapN, but goes on until the longest list ends, taking
+// the element at the same position of fills in place of the elements of
+// the lists that already ended. It panics unless there are as many fills
+// as lists.
+//	ZipLongestWith(sum, []I{0, 100}, L(1, 2, 3), L(10)) // L(11, 102, 103)
+func ZipLongestWith(f func(...I) I, fills []I, thunks ...*Thunk) *Thunk {
+	if len(fills) != len(thunks) {
+		panic("There must be a fill value for each list.")
+	}
+	return MakeThunk(func() *Pair {
+		l := len(thunks)
+		heads := make([](I), l)
+		tails := make([]*Thunk, l)
+		ended := true
+		for k := 0; k < l; k++ {
+			pair := force(thunks[k])
+			if pair == nil {
+				heads[k], tails[k] = fills[k], Empty
+				continue
+			}
+			heads[k], tails[k] = pair.Head, pair.Tail
+			ended = false
+		}
+		if ended {
+			return nil
+		}
+		return &Pair{f(heads...), ZipLongestWith(f, fills, tails...)}
+	})
+}
+
+// Reduces a finite list concurrently: the list is split into contiguous
+// ranges, each reduced by its own goroutine starting from identity, and
+// the partial results are then combined pairwise as a tree. f must be
+// associative and identity its identity element, so that the grouping
+// doesn't change the result; the order of elements is preserved, so f
+// doesn't need to be commutative. If workers <= 0, runtime.NumCPU()
+// workers are used.
+func (thunk *Thunk) ParFoldTree(f func(I, I) I, identity I, workers int) I {
+	items := thunk.ToSlice()
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(items) {
+		workers = len(items)
+	}
+	if workers == 0 {
+		return identity
+	}
+	partials := make([]I, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			acc := identity
+			for _, x := range items[w*len(items)/workers : (w+1)*len(items)/workers] {
+				acc = f(acc, x)
+			}
+			partials[w] = acc
+		}(w)
+	}
+	wg.Wait()
+	for len(partials) > 1 {
+		next := partials[:0]
+		for k := 0; k < len(partials); k += 2 {
+			if k+1 < len(partials) {
+				next = append(next, f(partials[k], partials[k+1]))
+			} else {
+				next = append(next, partials[k])
+			}
+		}
+		partials = next
+	}
+	return partials[0]
+}
+
+// Retrieves the first element of the list that passes a testing function.
+// ok is false if there is none. It stops at the first match, so it works
+// on infinite lists as long as some element passes.
+func (thunk *Thunk) Find(f func(I) bool) (x I, ok bool) {
+	for pair := force(thunk); pair != nil; pair = force(pair.Tail) {
+		if f(pair.Head) {
+			return pair.Head, true
+		}
+	}
+	return nil, false
+}
+
+// Retrieves the position of the first element of the list that passes a
+// testing function, or -1 and false if there is none. It forces the list
+// only up to the first match, so it works on infinite lists as long as
+// some element passes.
+func (thunk *Thunk) FindIndex(f func(I) bool) (int, bool) {
+	i := 0
+	for pair := force(thunk); pair != nil; pair = force(pair.Tail) {
+		if f(pair.Head) {
+			return i, true
+		}
+		i++
+	}
+	return -1, false
+}
+
+// Makes a slice with the first n elements of a list, or all of them if it
+// is shorter.
+func (thunk *Thunk) FirstN(n uint) []I {
+	return thunk.Take(n).ToSlice()
+}
+
+// Makes a slice with the last n elements of a list, or all of them if it
+// is shorter. The list must be finite.
+func (thunk *Thunk) LastN(n uint) []I {
+	ring := make([]I, 0, n)
+	next := 0
+	for pair := force(thunk); pair != nil && n > 0; pair = force(pair.Tail) {
+		if uint(len(ring)) < n {
+			ring = append(ring, pair.Head)
+		} else {
+			ring[next] = pair.Head
+			next = (next + 1) % len(ring)
+		}
+	}
+	return append(ring[next:], ring[:next]...)
+}
+
+// Splits a list into its maximal non-decreasing runs according to less,
+// listing each run as a list. Runs are computed as they are needed, so it
+// works on infinite lists as long as every run is finite.
+//	L(1, 3, 2, 2, 5, 4).MonotonicRuns(intLess) // L(L(1, 3), L(2, 2, 5), L(4))
+func (thunk *Thunk) MonotonicRuns(less func(a, b I) bool) *Thunk {
+	return MakeThunk(func() *Pair {
+		pair := force(thunk)
+		if pair == nil {
+			return nil
+		}
+		run := []I{pair.Head}
+		rest := pair.Tail
+		for next := force(rest); next != nil && !less(next.Head, run[len(run)-1]); next = force(rest) {
+			run = append(run, next.Head)
+			rest = next.Tail
+		}
+		return &Pair{SliceToList(run), rest.MonotonicRuns(less)}
+	})
+}
+
+// Counts the elements of a finite list that pass a testing function.
+func (thunk *Thunk) Count(f func(I) bool) (ret int) {
+	for pair := force(thunk); pair != nil; pair = force(pair.Tail) {
+		if f(pair.Head) {
+			ret++
+		}
+	}
+	return
+}
+
+// Applies a function that makes a list to each element of a list, and
+// appends all the resulting lists together. Works on infinite lists as
+// long as the lists made by the function are finite.
+//	L(1, 2, 3).FlatMap(func(x I) *Thunk { return L(x, x) }) // L(1, 1, 2, 2, 3, 3)
+func (thunk *Thunk) FlatMap(f func(I) *Thunk) *Thunk {
+	return MakeThunk(func() *Pair {
+		for pair := force(thunk); pair != nil; pair = force(pair.Tail) {
+			if inner := force(f(pair.Head)); inner != nil {
+				return &Pair{inner.Head, inner.Tail.Append(pair.Tail.FlatMap(f))}
+			}
+		}
+		return nil
+	})
+}
+
+// Groups consecutive elements into lists. Elements are added one by one
+// to a buffer; before adding each of them, flush is called with the
+// buffer so far and the element, and if it returns true the buffer is
+// listed and the element starts a new one. The last buffer is listed when
+// the list ends. flush is never called with an empty buffer.
+//	// Batches of at most 3 elements.
+//	l.BufferUntil(func(buffer []I, next I) bool {
+//		return len(buffer) == 3
+//	})
+func (thunk *Thunk) BufferUntil(flush func(buffer []I, next I) bool) *Thunk {
+	return MakeThunk(func() *Pair {
+		pair := force(thunk)
+		if pair == nil {
+			return nil
+		}
+		buffer := []I{pair.Head}
+		rest := pair.Tail
+		for next := force(rest); next != nil && !flush(buffer, next.Head); next = force(rest) {
+			buffer = append(buffer, next.Head)
+			rest = next.Tail
+		}
+		return &Pair{SliceToList(buffer), rest.BufferUntil(flush)}
+	})
+}
+
+// Wraps a list to count how it is used. The returned function reports how
+// many times the wrapped list's thunks have been forced (memoization
+// permitting) and how many of those forces yielded an element, that is,
+// weren't the end of the list. Counting is safe for concurrent use.
+func (thunk *Thunk) WithMetrics() (*Thunk, func() (forced int, elements int)) {
+	var forced, elements int64
+	var wrap func(*Thunk) *Thunk
+	wrap = func(thunk *Thunk) *Thunk {
+		return MakeThunk(func() *Pair {
+			atomic.AddInt64(&forced, 1)
+			pair := force(thunk)
+			if pair == nil {
+				return nil
+			}
+			atomic.AddInt64(&elements, 1)
+			return &Pair{pair.Head, wrap(pair.Tail)}
+		})
+	}
+	return wrap(thunk), func() (int, int) {
+		return int(atomic.LoadInt64(&forced)), int(atomic.LoadInt64(&elements))
+	}
+}
+
+// Performs just like Reduce, but lists every accumulated value, starting
+// with the initial one. It is lazy, so it works on infinite lists.
+//	L(1, 2, 3).Scan(sum, 0) // L(0, 1, 3, 6)
+func (thunk *Thunk) Scan(f func(I, I) I, initial I) *Thunk {
+	return MakeThunk(func() *Pair {
+		return &Pair{initial, MakeThunk(func() *Pair {
+			pair := force(thunk)
+			if pair == nil {
+				return nil
+			}
+			return force(pair.Tail.Scan(f, f(initial, pair.Head)))
+		})}
+	})
+}
+
+// Splits a finite list into the elements that pass a testing function and
+// those that don't, in a single traversal and keeping their order.
+func (thunk *Thunk) Partition(f func(I) bool) (*Thunk, *Thunk) {
+	var pass, fail []I
+	for pair := force(thunk); pair != nil; pair = force(pair.Tail) {
+		if f(pair.Head) {
+			pass = append(pass, pair.Head)
+		} else {
+			fail = append(fail, pair.Head)
+		}
+	}
+	return List(pass...), List(fail...)
+}
+
+// Distributes the elements of a list round-robin into n lists: the i-th
+// element goes to the (i mod n)-th list. Each of them is lazy and can be
+// consumed independently of the others, even on infinite lists. They all
+// share the original list, so with memoization on, the elements forced by
+// the most advanced consumer stay in memory until the slowest reaches
+// them; with memoization off, each shard forces the original list again.
+// It panics if n is 0.
+func (thunk *Thunk) Shard(n uint) []*Thunk {
+	if n == 0 {
+		panic("Number of shards must be positive.")
+	}
+	shards := make([]*Thunk, n)
+	for i := range shards {
+		shards[i] = thunk.SelectModulo(n, uint(i))
+	}
+	return shards
+}
+
+// Groups runs of adjacent elements that are equal according to eq into
+// lists. Each element is compared to the first one of its group. Works on
+// infinite lists as long as every group is finite.
+//	L(1, 1, 2, 3, 3, 3).GroupBy(intEq) // L(L(1, 1), L(2), L(3, 3, 3))
+func (thunk *Thunk) GroupBy(eq func(I, I) bool) *Thunk {
+	return MakeThunk(func() *Pair {
+		pair := force(thunk)
+		if pair == nil {
+			return nil
+		}
+		group := []I{pair.Head}
+		rest := pair.Tail
+		for next := force(rest); next != nil && eq(pair.Head, next.Head); next = force(rest) {
+			group = append(group, next.Head)
+			rest = next.Tail
+		}
+		return &Pair{SliceToList(group), rest.GroupBy(eq)}
+	})
+}
+
+// Lists the nodes of a tree in depth-first order (pre-order), given its
+// root and a function that lists the children of a node. Nodes are visited
+// as the list is forced, so it works on infinite trees.
+func ExpandDFS(root I, children func(I) *Thunk) *Thunk {
+	return MakeThunk(func() *Pair {
+		return &Pair{root, children(root).FlatMap(func(child I) *Thunk {
+			return ExpandDFS(child, children)
+		})}
+	})
+}
+
+// Lists the nodes of a tree in breadth-first order, given its root and a
+// function that lists the children of a node. Nodes are visited as the
+// list is forced, so it works on infinite trees as long as every level
+// is finite.
+func ExpandBFS(root I, children func(I) *Thunk) *Thunk {
+	levels := Updating(L(root), func(level I) I {
+		return level.(*Thunk).FlatMap(children)
+	}).TakeWhile(func(level I) bool {
+		return !level.(*Thunk).IsEmpty()
+	})
+	return levels.FlatMap(func(level I) *Thunk {
+		return level.(*Thunk)
+	})
+}
+
+// Lists the elements of a list without repetitions (according to
+// reflect.DeepEqual, like Has), in order of first appearance. Works on
+// infinite lists, but finding each next element needs the list to have
+// one, and every distinct element seen so far is kept in memory.
+func (thunk *Thunk) Distinct() *Thunk {
+	var distinct func(*Thunk, []I) *Thunk
+	distinct = func(thunk *Thunk, seen []I) *Thunk {
+		return MakeThunk(func() *Pair {
+		next:
+			for pair := force(thunk); pair != nil; pair = force(pair.Tail) {
+				for _, x := range seen {
+					if reflect.DeepEqual(x, pair.Head) {
+						continue next
+					}
+				}
+				seen := append(seen[:len(seen):len(seen)], pair.Head)
+				return &Pair{pair.Head, distinct(pair.Tail, seen)}
+			}
+			return nil
+		})
+	}
+	return distinct(thunk, nil)
+}
+
+// Wraps a list with its own cache of at most capacity forced elements,
+// by position, discarding the least recently used one when full. onEvict,
+// if not nil, is called with each discarded element, e.g. to release its
+// resources. Forcing a cached position of the wrapped list doesn't force
+// the original one again. The cache works whatever the global memoization
+// setting is, but it only bounds memory when it is off, since otherwise
+// the wrapped list's own thunks keep every forced element anyway. It panics
+// if capacity is negative.
+func (thunk *Thunk) MemoizeLRU(capacity int, onEvict func(I)) *Thunk {
+	if capacity < 0 {
+		panic("Cache capacity must not be negative.")
+	}
+	type entry struct {
+		index int
+		pair  *Pair
+	}
+	var mu sync.Mutex
+	order := list.New()
+	cache := map[int]*list.Element{}
+	var wrap func(*Thunk, int) *Thunk
+	wrap = func(thunk *Thunk, index int) *Thunk {
+		return MakeThunk(func() *Pair {
+			mu.Lock()
+			if e, ok := cache[index]; ok {
+				order.MoveToFront(e)
+				pair := e.Value.(entry).pair
+				mu.Unlock()
+				return &Pair{pair.Head, wrap(pair.Tail, index+1)}
+			}
+			mu.Unlock()
+			pair := force(thunk)
+			if pair == nil {
+				return nil
+			}
+			mu.Lock()
+			if _, ok := cache[index]; !ok && capacity > 0 {
+				cache[index] = order.PushFront(entry{index, pair})
+			}
+			var evicted []I
+			for order.Len() > capacity {
+				e := order.Remove(order.Back()).(entry)
+				delete(cache, e.index)
+				evicted = append(evicted, e.pair.Head)
+			}
+			mu.Unlock()
+			if onEvict != nil {
+				for _, x := range evicted {
+					onEvict(x)
+				}
+			}
+			return &Pair{pair.Head, wrap(pair.Tail, index+1)}
+		})
+	}
+	return wrap(thunk, 0)
+}
+
+// Splits a list into its first n elements and the rest, the same as
+// Take(n) and Drop(n). Both are lazy, so it works on infinite lists.
+func (thunk *Thunk) SplitAt(n uint) (*Thunk, *Thunk) {
+	return thunk.Take(n), thunk.Drop(n)
+}
+
+// Makes a list with x inserted at position n, so that it becomes the
+// element at n. If the list has fewer than n elements, x is appended at
+// its end. The elements after x are the original list's own pairs.
+//	L(1, 2, 3).InsertAt(1, 9) // L(1, 9, 2, 3)
+func (thunk *Thunk) InsertAt(n uint, x I) *Thunk {
+	return MakeThunk(func() *Pair {
+		if n == 0 {
+			return &Pair{x, thunk}
+		}
+		pair := force(thunk)
+		if pair == nil {
+			return &Pair{x, Empty}
+		}
+		return &Pair{pair.Head, pair.Tail.InsertAt(n-1, x)}
+	})
+}
+
+// Makes a list without the element at position n. If the list has no
+// element at n, the result has the same elements as the list. The
+// elements after the removed one are the original list's own pairs.
+//	L(1, 2, 3).RemoveAt(1) // L(1, 3)
+func (thunk *Thunk) RemoveAt(n uint) *Thunk {
+	return MakeThunk(func() *Pair {
+		pair := force(thunk)
+		if pair == nil {
+			return nil
+		}
+		if n == 0 {
+			return force(pair.Tail)
+		}
+		return &Pair{pair.Head, pair.Tail.RemoveAt(n - 1)}
+	})
+}
+
+// Makes a list with x in place of the element at position n. If the list
+// has no element at n, the result has the same elements as the list. The
+// elements after the replaced one are the original list's own pairs.
+//	L(1, 2, 3).UpdateAt(1, 9) // L(1, 9, 3)
+func (thunk *Thunk) UpdateAt(n uint, x I) *Thunk {
+	return MakeThunk(func() *Pair {
+		pair := force(thunk)
+		if pair == nil {
+			return nil
+		}
+		if n == 0 {
+			return &Pair{x, pair.Tail}
+		}
+		return &Pair{pair.Head, pair.Tail.UpdateAt(n-1, x)}
+	})
+}
+
+// Makes a slice of slices from a finite list of finite lists. It fails if
+// any element of the list isn't a list.
+func (thunk *Thunk) ToSlice2D() ([][]I, error) {
+	ret := [][]I{}
+	for pair := force(thunk); pair != nil; pair = force(pair.Tail) {
+		row, ok := pair.Head.(*Thunk)
+		if !ok {
+			return nil, fmt.Errorf("functional: element %d is %T, not a list", len(ret), pair.Head)
+		}
+		ret = append(ret, row.ToSlice())
+	}
+	return ret, nil
+}
+
+// Makes a map from a finite list of two-element lists, the first element
+// of each being the key and the second one the value. Later pairs override
+// earlier ones with the same key. It fails if any element isn't a list of
+// two elements or its key can't be used as a map key.
+//	L(1, 2).Zip(L("a", "b")).ToMap() // map[1:a 2:b]
+func (thunk *Thunk) ToMap() (map[I]I, error) {
+	ret := map[I]I{}
+	i := 0
+	for pair := force(thunk); pair != nil; pair = force(pair.Tail) {
+		kv, ok := pair.Head.(*Thunk)
+		if ok {
+			n, completed := kv.LengthAtMost(2)
+			ok = n == 2 && completed
+		}
+		if !ok {
+			return nil, fmt.Errorf("functional: element %d is not a key/value pair", i)
+		}
+		k := force(kv)
+		if k.Head != nil && !reflect.ValueOf(k.Head).Comparable() {
+			return nil, fmt.Errorf("functional: key of element %d (%T) is not hashable", i, k.Head)
+		}
+		ret[k.Head] = force(k.Tail).Head
+		i++
+	}
+	return ret, nil
+}
+
+// Splits a list into its longest prefix of elements that pass a testing
+// function and the rest, the same as TakeWhile(f) and DropWhile(f). Both
+// are lazy, so it works on infinite lists.
+func (thunk *Thunk) Span(f func(I) bool) (*Thunk, *Thunk) {
+	return thunk.TakeWhile(f), thunk.DropWhile(f)
+}
+
+// Performs like Scan, but keeps a separate accumulated value for each key,
+// as given by the key function, starting each of them at initial. For
+// each element, the updated value for its key is listed. Keys must be
+// valid map keys. Works on infinite lists, but the value for every key
+// seen so far is kept in memory.
+func (thunk *Thunk) ScanByKey(key func(I) I, f func(acc, x I) I, initial I) *Thunk {
+	accs := map[I]I{}
+	var scan func(*Thunk) *Thunk
+	scan = func(thunk *Thunk) *Thunk {
+		return makeOnceThunk(func() *Pair {
+			pair := force(thunk)
+			if pair == nil {
+				return nil
+			}
+			k := key(pair.Head)
+			acc, ok := accs[k]
+			if !ok {
+				acc = initial
+			}
+			acc = f(acc, pair.Head)
+			accs[k] = acc
+			return &Pair{acc, scan(pair.Tail)}
+		})
+	}
+	return scan(thunk)
+}
+
+// Splits a list into lists of size elements; the last one may be shorter.
+// It panics if size is 0.
+//	L(1, 2, 3, 4, 5).Chunk(2) // L(L(1, 2), L(3, 4), L(5))
+func (thunk *Thunk) Chunk(size uint) *Thunk {
+	if size == 0 {
+		panic("Chunk size must be positive.")
+	}
+	return MakeThunk(func() *Pair {
+		chunk := thunk.Take(size).ToSlice()
+		if len(chunk) == 0 {
+			return nil
+		}
+		return &Pair{SliceToList(chunk), thunk.Drop(size).Chunk(size)}
+	})
+}
+
+// Makes a list that is built by factory the first time it is forced. Useful
+// for self-referential lists, without the need for DelayedLink:
+//	var fibo *Thunk
+//	fibo = Link(1, Link(1, Defer(func() *Thunk {
+//		return MapN(sum, fibo, fibo.Tail())
+//	})))
+func Defer(factory func() *Thunk) *Thunk {
+	return makeOnceThunk(func() *Pair {
+		return force(factory())
+	})
+}
+
+// Groups the elements of a finite list by key and reduces each group with
+// f, using up to workers goroutines (runtime.NumCPU() if workers <= 0).
+// Lists a (key, reduced value) list for each key, in no particular order.
+// Keys must be valid map keys. Each group is reduced in order starting
+// from its first element, but f should be associative, as groups may be
+// reduced in any order.
+func (thunk *Thunk) ParReduceByKey(key func(I) I, f func(I, I) I, workers int) *Thunk {
+	var keys []I
+	groups := map[I][]I{}
+	for pair := force(thunk); pair != nil; pair = force(pair.Tail) {
+		k := key(pair.Head)
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], pair.Head)
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	results := make([]I, len(keys))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				values := groups[keys[i]]
+				acc := values[0]
+				for _, x := range values[1:] {
+					acc = f(acc, x)
+				}
+				results[i] = L(keys[i], acc)
+			}
+		}()
+	}
+	for i := range keys {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return List(results...)
+}
+
+// Lists every window of size consecutive elements of a list, advancing one
+// element at a time. A list shorter than size has no windows. It panics if
+// size is 0.
+//	L(1, 2, 3, 4).Windows(2) // L(L(1, 2), L(2, 3), L(3, 4))
+func (thunk *Thunk) Windows(size uint) *Thunk {
+	return thunk.WindowedReduce(size, 1, func(xs ...I) I {
+		return List(xs...)
+	})
+}
+
+// Lists the elements of a list skipping those equal (according to
+// reflect.DeepEqual) to any of the previous window elements. Unlike
+// Distinct, it only remembers the last window elements, so it works on
+// infinite lists with bounded memory.
+func (thunk *Thunk) DistinctWithin(window uint) *Thunk {
+	var distinct func(*Thunk, []I) *Thunk
+	distinct = func(thunk *Thunk, recent []I) *Thunk {
+		return MakeThunk(func() *Pair {
+			recent := recent
+			for pair := force(thunk); pair != nil; pair = force(pair.Tail) {
+				dup := false
+				for _, x := range recent {
+					if reflect.DeepEqual(x, pair.Head) {
+						dup = true
+						break
+					}
+				}
+				if window > 0 {
+					if uint(len(recent)) == window {
+						recent = recent[1:]
+					}
+					recent = append(recent[:len(recent):len(recent)], pair.Head)
+				}
+				if !dup {
+					return &Pair{pair.Head, distinct(pair.Tail, recent)}
+				}
+			}
+			return nil
+		})
+	}
+	return distinct(thunk, nil)
+}
+
+// Interleaves the elements of the list with those of some other lists,
+// taking one from each in turn. Lists that end are skipped, and it goes on
+// until all of them end.
+//	L(1, 2, 3).RoundRobin(L("a"), L(true, false)) // L(1, "a", true, 2, false, 3)
+func (thunk *Thunk) RoundRobin(others ...*Thunk) *Thunk {
+	var roundRobin func([]*Thunk) *Thunk
+	roundRobin = func(thunks []*Thunk) *Thunk {
+		return MakeThunk(func() *Pair {
+			for k, thunk := range thunks {
+				if pair := force(thunk); pair != nil {
+					next := append(append([]*Thunk{}, thunks[k+1:]...), pair.Tail)
+					return &Pair{pair.Head, roundRobin(next)}
+				}
+			}
+			return nil
+		})
+	}
+	return roundRobin(append([]*Thunk{thunk}, others...))
+}
+
+// Makes a single list by appending some lists one after another.
+//	Concat(L(1, 2), L(3), L(4, 5)) // L(1, 2, 3, 4, 5)
+func Concat(thunks ...*Thunk) *Thunk {
+	var concat func(*Thunk, []*Thunk) *Thunk
+	concat = func(thunk *Thunk, rest []*Thunk) *Thunk {
+		return MakeThunk(func() *Pair {
+			pair, rest := force(thunk), rest
+			for pair == nil && len(rest) > 0 {
+				pair, rest = force(rest[0]), rest[1:]
+			}
+			if pair == nil {
+				return nil
+			}
+			return &Pair{pair.Head, concat(pair.Tail, rest)}
+		})
+	}
+	return concat(Empty, append([]*Thunk{}, thunks...))
+}
+
+// Makes a single list by appending the lists in a list of lists one after
+// another. Unlike folding with Append, each element is reached in constant
+// time, however many lists there are, and empty lists are skipped.
+//	ConcatAll(L(L(1, 2), L(), L(3))) // L(1, 2, 3)
+func ConcatAll(lists *Thunk) *Thunk {
+	var concat func(*Thunk, *Thunk) *Thunk
+	concat = func(thunk *Thunk, rest *Thunk) *Thunk {
+		return MakeThunk(func() *Pair {
+			pair, rest := force(thunk), rest
+			for pair == nil {
+				next := force(rest)
+				if next == nil {
+					return nil
+				}
+				pair, rest = force(next.Head.(*Thunk)), next.Tail
+			}
+			return &Pair{pair.Head, concat(pair.Tail, rest)}
+		})
+	}
+	return concat(Empty, lists)
+}
+
+// Combines the elements of two lists pairwise with a function, stopping
+// when any of them ends.
+//	L(1, 2, 3).ZipWith(L(10, 20, 30), add) // L(11, 22, 33)
+func (thunk *Thunk) ZipWith(other *Thunk, f func(I, I) I) *Thunk {
+	return MapN(func(xs ...I) I {
+		return f(xs[0], xs[1])
+	}, thunk, other)
+}
+
+// Repeats the elements of a finite list forever. The result loops back to
+// its own beginning, so taking long prefixes doesn't take more memory.
+// Cycling an empty list gives an empty list.
+//	L(1, 2, 3).Cycle().Take(7) // L(1, 2, 3, 1, 2, 3, 1)
+func (thunk *Thunk) Cycle() *Thunk {
+	var cycle *Thunk
+	cycle = MakeThunk(func() *Pair {
+		return force(Concat(thunk, cycle))
+	})
+	return MakeThunk(func() *Pair {
+		if force(thunk) == nil {
+			return nil
+		}
+		return force(cycle)
+	})
+}
+
+// Makes an infinite list whose elements are all x. The list is its own
+// tail, so it takes constant memory.
+//	Repeat("z").Take(3) // L("z", "z", "z")
+func Repeat(x I) *Thunk {
+	var repeat *Thunk
+	repeat = MakeThunk(func() *Pair { return &Pair{x, repeat} })
+	return repeat
+}
+
+// Makes a list of n elements, all of them x.
+//	Replicate(3, "z") // L("z", "z", "z")
+func Replicate(n uint, x I) *Thunk {
+	return Repeat(x).Take(n)
+}
+
+// Retrieves the position of the first element of the list equal to x
+// (according to reflect.DeepEqual, like Has), or -1 if there is none.
+func (thunk *Thunk) IndexOf(x I) int {
+	i, _ := thunk.FindIndex(func(y I) bool {
+		return reflect.DeepEqual(x, y)
+	})
+	return i
+}
+
+// Tests if a list contains an element equal to x according to eq, which
+// takes x first and then each element.
+func (thunk *Thunk) HasBy(x I, eq func(I, I) bool) bool {
+	_, ok := thunk.FindBy(x, eq)
+	return ok
+}
+
+// Retrieves the first element of the list equal to x according to eq,
+// which takes x first and then each element. ok is false if there is none.
+//	L("Go", "Rust").FindBy("go", strings.EqualFold) // "Go", true
+func (thunk *Thunk) FindBy(x I, eq func(I, I) bool) (I, bool) {
+	return thunk.Find(func(y I) bool {
+		return eq(x, y)
+	})
+}
+
+// Retrieves the position of the first element of the list equal to x
+// according to eq, which takes x first and then each element, or -1 if
+// there is none.
+func (thunk *Thunk) IndexBy(x I, eq func(I, I) bool) int {
+	i, _ := thunk.FindIndex(func(y I) bool {
+		return eq(x, y)
+	})
+	return i
+}
+
+// Folds a list from the right. f takes each element and a function that
+// returns the fold of the rest of the list, which it only needs to call if
+// it actually uses it; initial is the fold of the empty list. Since f can
+// ignore the rest, it works on infinite lists as long as f eventually does.
+//	// Any element greater than 10?
+//	prog.Foldr(func(x I, rest func() I) I {
+//		return x.(int) > 10 || rest().(bool)
+//	}, false)
+func (thunk *Thunk) Foldr(f func(I, func() I) I, initial I) I {
+	pair := force(thunk)
+	if pair == nil {
+		return initial
+	}
+	return f(pair.Head, func() I {
+		return pair.Tail.Foldr(f, initial)
+	})
+}
+
+// Compares two elements of the ordered kinds that Max and Min handle
+// (ints, uints, floats and strings). Elements of different kinds, or of
+// any other kind, are ordered by their reflect.Kind.
+func orderedLess(a, b I) bool {
+	aV, bV := reflect.ValueOf(a), reflect.ValueOf(b)
+	if aV.Kind() != bV.Kind() {
+		return aV.Kind() < bV.Kind()
+	}
+	switch aV.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return aV.Int() < bV.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return aV.Uint() < bV.Uint()
+	case reflect.Float32, reflect.Float64:
+		return aV.Float() < bV.Float()
+	case reflect.String:
+		return aV.String() < bV.String()
+	}
+	return false
+}
+
+// Sorts a finite list of ordered elements (ints, uints, floats or strings)
+// in ascending order. Mixed lists are sorted by kind first, as given by
+// reflect.Kind (so all ints come before all floats, which come before all
+// strings), and then by value. Elements of other kinds are left in their
+// original order, after the ordered ones of lesser kinds.
+func (thunk *Thunk) Sort() *Thunk {
+	items := thunk.ToSlice()
+	sort.SliceStable(items, func(i, j int) bool {
+		return orderedLess(items[i], items[j])
+	})
+	return List(items...)
+}
+
+// Sorts a finite list according to less. The sort is stable: elements that
+// are neither less than each other keep their original order.
+func (thunk *Thunk) SortBy(less func(I, I) bool) *Thunk {
+	items := thunk.ToSlice()
+	sort.SliceStable(items, func(i, j int) bool {
+		return less(items[i], items[j])
+	})
+	return List(items...)
+}
+
+// The most elements MarshalJSON encodes from a single list before giving
+// up, since it can't tell an infinite list from a long one.
+const maxJSONLength = 1 << 20
+
+// Encodes a list as a JSON array of its elements, nested lists as nested
+// arrays. Implements json.Marshaler. Lists of more than 1<<20 elements,
+// such as infinite ones, fail.
+func (thunk *Thunk) MarshalJSON() ([]byte, error) {
+	buf := bytes.NewBufferString("[")
+	n := 0
+	for pair := force(thunk); pair != nil; pair = force(pair.Tail) {
+		if n == maxJSONLength {
+			return nil, fmt.Errorf("functional: list longer than %d elements", maxJSONLength)
+		}
+		if n > 0 {
+			buf.WriteByte(',')
+		}
+		data, err := json.Marshal(pair.Head)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+		n++
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// Makes a list from a JSON array. Nested arrays become nested lists,
+// integral numbers become ints and other numbers float64s; strings,
+// booleans, nulls and objects are decoded as by encoding/json. It fails if
+// data holds anything but a single array, including a null.
+func FromJSON(data []byte) (*Thunk, error) {
+	var items []interface{}
+	if err := decodeJSON(data, &items); err != nil {
+		return nil, err
+	}
+	if items == nil {
+		return nil, errors.New("functional: JSON null is not an array")
+	}
+	return fromJSONValue(items).(*Thunk), nil
+}
+
+// Decodes the single JSON value in data into v, keeping numbers as
+// json.Number.
+func decodeJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("functional: unexpected data after JSON value")
+	}
+	return nil
+}
+
+// Makes an int from an integral JSON number that fits in one, and a
+// float64 from any other.
+func fromJSONNumber(n json.Number) I {
+	if i, err := n.Int64(); err == nil && int64(int(i)) == i {
+		return int(i)
+	}
+	f, _ := n.Float64()
+	return f
+}
+
+// Replaces the json.Numbers in a decoded JSON value, however deep, as
+// fromJSONNumber does, leaving arrays as slices.
+func fromJSONNumbers(v interface{}) I {
+	switch v := v.(type) {
+	case []interface{}:
+		for i, x := range v {
+			v[i] = fromJSONNumbers(x)
+		}
+	case map[string]interface{}:
+		for k, x := range v {
+			v[k] = fromJSONNumbers(x)
+		}
+	case json.Number:
+		return fromJSONNumber(v)
+	}
+	return v
+}
+
+func fromJSONValue(v interface{}) I {
+	switch v := v.(type) {
+	case []interface{}:
+		ret := Empty
+		for i := len(v) - 1; i >= 0; i-- {
+			ret = Link(fromJSONValue(v[i]), ret)
+		}
+		return ret
+	case map[string]interface{}:
+		for k, x := range v {
+			v[k] = fromJSONValue(x)
+		}
+	case json.Number:
+		return fromJSONNumber(v)
+	}
+	return v
+}
+
+// Fills a new Thunk with the list in a JSON array, as decoded by FromJSON,
+// which is what encoding/json does for a nil *Thunk. Lists are shared, so
+// it fails on a Thunk that is already a list, such as Empty, instead of
+// changing it. Implements json.Unmarshaler.
+func (thunk *Thunk) UnmarshalJSON(data []byte) error {
+	list, err := FromJSON(data)
+	if err != nil {
+		return err
+	}
+	return thunk.become(list)
+}
+
+// Makes a list of the lines read from r, as strings without their line
+// endings. Lines are read as the list is forced. The list ends at EOF; if
+// reading fails, the error is the last element of the list, right after
+// the part of the line read before the failure, if any.
+func FromReaderLines(r io.Reader) *Thunk {
+	br := bufio.NewReader(r)
+	var next func() *Pair
+	next = func() *Pair {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			if line != "" {
+				return &Pair{strings.TrimSuffix(line, "\r"), L(err)}
+			}
+			return &Pair{err, Empty}
+		}
+		if err == io.EOF && line == "" {
+			return nil
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		return &Pair{line, makeOnceThunk(next)}
+	}
+	return makeOnceThunk(next)
+}
+
+// Writes each element of a finite list to w, formatted with format as by
+// fmt.Sprintf, followed by a newline. Elements are written as the list is
+// traversed. Returns the number of bytes written and the first error.
+func (thunk *Thunk) WriteFormatted(w io.Writer, format string) (int64, error) {
+	var total int64
+	for pair := force(thunk); pair != nil; pair = force(pair.Tail) {
+		line := fmt.Sprintf(format, pair.Head) + "\n"
+		n, err := io.WriteString(w, line)
+		total += int64(n)
+		if err == nil && n < len(line) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// Writes each element of a finite list to w in its default format, one
+// per line. Implements io.WriterTo; see WriteFormatted for other formats.
+func (thunk *Thunk) WriteTo(w io.Writer) (int64, error) {
+	return thunk.WriteFormatted(w, "%v")
+}
+
+// Makes a list of the values received from ch, ending when it is closed.
+// Each value is received when the list is forced up to it, and only once,
+// even if memoization is off.
+func FromChan(ch <-chan I) *Thunk {
+	return makeOnceThunk(func() *Pair {
+		x, ok := <-ch
+		if !ok {
+			return nil
+		}
+		return &Pair{x, FromChan(ch)}
+	})
+}
+
+// Performs just like Map, but applies the function to the elements of a
+// finite list concurrently, using up to workers goroutines
+// (runtime.NumCPU() if workers <= 0). The order of the elements is kept.
+// Unlike Map, it isn't lazy: the function has been applied to every
+// element when it returns.
+func (thunk *Thunk) PMap(f func(I) I, workers int) *Thunk {
+	items := thunk.ToSlice()
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				items[i] = f(items[i])
+			}
+		}()
+	}
+	for i := range items {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return List(items...)
+}
+
+// Performs just like Reduce, but checks ctx before each element and stops,
+// returning ctx.Err() along with the value accumulated so far, once it is
+// done. Useful to bound the time spent on huge or infinite lists.
+func (thunk *Thunk) ReduceContext(ctx context.Context, f func(I, I) I, initial I) (I, error) {
+	acc := initial
+	for pair := force(thunk); pair != nil; pair = force(pair.Tail) {
+		select {
+		case <-ctx.Done():
+			return acc, ctx.Err()
+		default:
+		}
+		acc = f(acc, pair.Head)
+	}
+	return acc, nil
+}
+
+// Performs just like Reduce, but stops at the first element for which f
+// returns false as its second value. That element is left unconsumed: its
+// accumulated value is discarded and it heads the returned rest, which is
+// empty if the whole list was folded. Useful to consume a prefix of a list
+// and go on with the rest, even if it is infinite.
+//	// Sums while the total stays under 10: 6, L(4, 5)
+//	L(1, 2, 3, 4, 5).FoldWhile(func(acc, x I) (I, bool) {
+//		sum := acc.(int) + x.(int)
+//		return sum, sum < 10
+//	}, 0)
+func (thunk *Thunk) FoldWhile(f func(acc, x I) (I, bool), initial I) (I, *Thunk) {
+	acc := initial
+	for {
+		pair := force(thunk)
+		if pair == nil {
+			return acc, Empty
+		}
+		next, ok := f(acc, pair.Head)
+		if !ok {
+			return acc, thunk
+		}
+		acc, thunk = next, pair.Tail
+	}
+}
+
+// Retrieves the element of a finite list for which key returns the
+// greatest value. On ties, the first of them is returned. An empty list
+// gives nil.
+func (thunk *Thunk) MaxBy(key func(I) float64) (ret I) {
+	var best float64
+	for pair, first := force(thunk), true; pair != nil; pair, first = force(pair.Tail), false {
+		if k := key(pair.Head); first || k > best {
+			ret, best = pair.Head, k
+		}
+	}
+	return
+}
+
+// Retrieves the element of a finite list for which key returns the
+// least value. On ties, the first of them is returned. An empty list
+// gives nil.
+func (thunk *Thunk) MinBy(key func(I) float64) (ret I) {
+	var best float64
+	for pair, first := force(thunk), true; pair != nil; pair, first = force(pair.Tail), false {
+		if k := key(pair.Head); first || k < best {
+			ret, best = pair.Head, k
+		}
+	}
+	return
+}
+
+// Converts an integer value (an int or uint of any size) to int.
+func toInt(x I) (int, bool) {
+	v := reflect.ValueOf(x)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint()), true
+	}
+	return 0, false
+}
+
+// Adds up the elements of a finite list of integers (of any size). It
+// panics if some element isn't an integer.
+func (thunk *Thunk) SumInts() int {
+	return thunk.Reduce(func(acc, x I) I {
+		n, ok := toInt(x)
+		if !ok {
+			panic(fmt.Sprintf("SumInts: %v (%T) is not an integer.", x, x))
+		}
+		return acc.(int) + n
+	}, 0).(int)
+}
+
+// Multiplies the elements of a finite list of integers (of any size). It
+// panics if some element isn't an integer.
+func (thunk *Thunk) ProductInts() int {
+	return thunk.Reduce(func(acc, x I) I {
+		n, ok := toInt(x)
+		if !ok {
+			panic(fmt.Sprintf("ProductInts: %v (%T) is not an integer.", x, x))
+		}
+		return acc.(int) * n
+	}, 1).(int)
+}
+
+// Adds up the elements of a finite list of numbers (floats, or ints or
+// uints, which are converted). It panics if some element isn't a number.
+func (thunk *Thunk) SumFloats() float64 {
+	return thunk.Reduce(func(acc, x I) I {
+		f, ok := toFloat(x)
+		if !ok {
+			panic(fmt.Sprintf("SumFloats: %v (%T) is not a number.", x, x))
+		}
+		return acc.(float64) + f
+	}, 0.0).(float64)
+}
+
+// Computes the arithmetic mean of a finite list of numbers (floats, or
+// ints or uints, which are converted). It fails if the list is empty or
+// some element isn't a number.
+func (thunk *Thunk) MeanFloats() (float64, error) {
+	var sum float64
+	n := 0
+	for pair := force(thunk); pair != nil; pair = force(pair.Tail) {
+		f, ok := toFloat(pair.Head)
+		if !ok {
+			return 0, fmt.Errorf("functional: %v (%T) is not a number", pair.Head, pair.Head)
+		}
+		sum += f
+		n++
+	}
+	if n == 0 {
+		return 0, errors.New("functional: mean of an empty list")
+	}
+	return sum / float64(n), nil
+}
+
+// Lists 0, 1, 2 and so on.
+func indices() *Thunk {
+	return Iterate(func(i I) I {
+		return i.(int) + 1
+	}, 0)
+}
+
+// Lists an (index, element) list for each element of a list.
+//	L("a", "b").Enumerate() // L(L(0, "a"), L(1, "b"))
+func (thunk *Thunk) Enumerate() *Thunk {
+	return ZipN(indices(), thunk)
+}
+
+// Performs just like Map, but the function also gets the position of each
+// element.
+func (thunk *Thunk) MapIndexed(f func(int, I) I) *Thunk {
+	return MapN(func(xs ...I) I {
+		return f(xs[0].(int), xs[1])
+	}, indices(), thunk)
+}
+
+// Performs just like Filter, but the testing function also gets the
+// position each element had in the original list.
+//	// Every third element.
+//	l.FilterIndexed(func(i int, x I) bool {
+//		return i%3 == 0
+//	})
+func (thunk *Thunk) FilterIndexed(f func(int, I) bool) *Thunk {
+	var filter func(*Thunk, int) *Thunk
+	filter = func(thunk *Thunk, i int) *Thunk {
+		return MakeThunk(func() *Pair {
+			for pair, i := force(thunk), i; pair != nil; pair, i = force(pair.Tail), i+1 {
+				if f(i, pair.Head) {
+					return &Pair{pair.Head, filter(pair.Tail, i+1)}
+				}
+			}
+			return nil
+		})
+	}
+	return filter(thunk, 0)
+}
+
+// Makes a single list from a list of lists, inserting the elements of sep
+// between each two of them.
+//	L(L(1, 2), L(3, 4)).Intercalate(L(0)) // L(1, 2, 0, 3, 4)
+func (thunk *Thunk) Intercalate(sep *Thunk) *Thunk {
+	return MakeThunk(func() *Pair {
+		pair := force(thunk)
+		if pair == nil {
+			return nil
+		}
+		rest := pair.Tail.FlatMap(func(x I) *Thunk {
+			return sep.Append(x.(*Thunk))
+		})
+		return force(pair.Head.(*Thunk).Append(rest))
+	})
+}
+
+// Makes two lists with the elements of a list, which can be consumed
+// independently. Both are backed by a single memoized view of the list,
+// whatever the memoization setting, so each of its thunks is forced only
+// once, even if it has side effects.
+func (thunk *Thunk) Tee() (*Thunk, *Thunk) {
+	shared := thunk.WithMemo(true)
+	return shared.WithMemo(true), shared.WithMemo(true)
+}
+
 func init() {
 	Empty = MakeThunk(func() *Pair { return nil })
 	memo = true
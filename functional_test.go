@@ -1,8 +1,22 @@
 package functional
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
 	"reflect"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 func TestEquals(t *testing.T) {
@@ -30,6 +44,16 @@ func TestSliceToList(t *testing.T) {
 	if !l.Equals(List(1, 2, 3, 4, 5)) || l.Equals(List(1, "a", 9)) {
 		t.Errorf("SliceToList(%v) -> %v", slice, l)
 	}
+	array := [5]int{1, 2, 3, 4, 5}
+	if a := SliceToList(array); !a.Equals(l) {
+		t.Errorf("SliceToList(%v) -> %v", array, a)
+	}
+	if a := SliceToList([0]int{}); !a.Equals(L()) {
+		t.Errorf("SliceToList([0]int{}) -> %v", a)
+	}
+	if a, err := SliceToListChecked(&array); err == nil || a != nil {
+		t.Errorf("SliceToListChecked(&array) -> %v, %v", a, err)
+	}
 }
 
 func TestToSlice(t *testing.T) {
@@ -40,6 +64,46 @@ func TestToSlice(t *testing.T) {
 	}
 }
 
+func TestSliceToListChecked(t *testing.T) {
+	l, err := SliceToListChecked([]string{"a", "b"})
+	if err != nil || !l.Equals(L("a", "b")) {
+		t.Errorf("%v, %v", l, err)
+	}
+	if l, err := SliceToListChecked([]int(nil)); err != nil || !l.Equals(L()) {
+		t.Errorf("%v, %v", l, err)
+	}
+	for _, x := range []I{nil, 1, map[int]int{1: 2}} {
+		if l, err := SliceToListChecked(x); err == nil || l != nil {
+			t.Errorf("SliceToListChecked(%v) -> %v, %v", x, l, err)
+		}
+	}
+}
+
+func TestFromMap(t *testing.T) {
+	m := map[string]int{"a": 1, "b": 2, "c": 3}
+	l := FromMap(m)
+	if n := l.Length(); n != len(m) {
+		t.Errorf("%v", l)
+	}
+	back, err := l.ToMap()
+	if err != nil || len(back) != len(m) {
+		t.Errorf("%v, %v", back, err)
+	}
+	for k, v := range m {
+		if back[k] != v {
+			t.Errorf("%v: %v != %v", k, back[k], v)
+		}
+	}
+	if l := FromMap(map[int]int{}); !l.Equals(L()) {
+		t.Errorf("%v", l)
+	}
+	for _, x := range []I{nil, 1, []int{1, 2}} {
+		if l := FromMap(x); l != nil {
+			t.Errorf("FromMap(%v) -> %v", x, l)
+		}
+	}
+}
+
 func TestAppend(t *testing.T) {
 	l1 := List(1, 2, 3)
 	l2 := List(4, 5, 6)
@@ -49,6 +113,32 @@ func TestAppend(t *testing.T) {
 	}
 }
 
+func TestAppendLong(t *testing.T) {
+	for _, memoOn := range []bool{true, false} {
+		if !memoOn {
+			StopMemo()
+		}
+		first := make([]int, 5000)
+		second := make([]int, 2000)
+		all := make([]int, 0, 7000)
+		for i := range first {
+			first[i] = i
+		}
+		for i := range second {
+			second[i] = 5000 + i
+		}
+		all = append(append(all, first...), second...)
+		l := SliceToList(first).Append(SliceToList(second))
+		if n := l.Length(); n != 7000 {
+			t.Errorf("memo %v: Length() -> %v", memoOn, n)
+		}
+		if !l.Equals(SliceToList(all)) {
+			t.Errorf("memo %v: elements differ", memoOn)
+		}
+		StartMemo()
+	}
+}
+
 func TestIter(t *testing.T) {
 	l := List(1, 2, "a", 4, 5)
 	s := []I{1, 2, "a", 4, 5}
@@ -61,6 +151,65 @@ func TestIter(t *testing.T) {
 	}
 }
 
+func TestIterContext(t *testing.T) {
+	naturals := Updating(1, func(x I) I {
+		return x.(int) + 1
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := naturals.IterContext(ctx)
+	if x := <-ch; x != 1 {
+		t.Errorf("%v", x)
+	}
+	cancel()
+	timeout := time.After(time.Second)
+	for open := true; open; {
+		select {
+		case _, open = <-ch:
+		case <-timeout:
+			t.Fatal("producer didn't stop")
+		}
+	}
+	l := L(1, 2, "a")
+	var got []I
+	for x := range l.IterContext(context.Background()) {
+		got = append(got, x)
+	}
+	if !reflect.DeepEqual(got, l.ToSlice()) {
+		t.Errorf("%v", got)
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	if !Empty.IsEmpty() || !L().IsEmpty() || L(1).IsEmpty() {
+		t.Error()
+	}
+	naturals := Updating(0, func(x I) I {
+		return x.(int) + 1
+	})
+	if naturals.IsEmpty() {
+		t.Error()
+	}
+}
+
+func TestHeadTailSafe(t *testing.T) {
+	if x, ok := L().HeadSafe(); ok || x != nil {
+		t.Errorf("%v, %v", x, ok)
+	}
+	if tl, ok := L().TailSafe(); ok || tl != nil {
+		t.Errorf("%v, %v", tl, ok)
+	}
+	l := L(1, 2)
+	if x, ok := l.HeadSafe(); !ok || x != 1 {
+		t.Errorf("%v, %v", x, ok)
+	}
+	if tl, ok := l.TailSafe(); !ok || !tl.Equals(L(2)) {
+		t.Errorf("%v, %v", tl, ok)
+	}
+	if tl, ok := L(1).TailSafe(); !ok || !tl.Equals(L()) {
+		t.Errorf("%v, %v", tl, ok)
+	}
+}
+
 func TestLength(t *testing.T) {
 	l1 := List(1, 2, 3)
 	l2 := List()
@@ -72,14 +221,45 @@ func TestLength(t *testing.T) {
 	}
 }
 
+func TestLengthAtMost(t *testing.T) {
+	l := L(1, 2, 3)
+	if n, ok := l.LengthAtMost(5); n != 3 || !ok {
+		t.Errorf("%v, %v", n, ok)
+	}
+	if n, ok := l.LengthAtMost(3); n != 3 || !ok {
+		t.Errorf("%v, %v", n, ok)
+	}
+	if n, ok := l.LengthAtMost(2); n != 2 || ok {
+		t.Errorf("%v, %v", n, ok)
+	}
+	if n, ok := L().LengthAtMost(0); n != 0 || !ok {
+		t.Errorf("%v, %v", n, ok)
+	}
+	naturals := Updating(0, func(x I) I {
+		return x.(int) + 1
+	})
+	if n, ok := naturals.LengthAtMost(1000); n != 1000 || ok {
+		t.Errorf("%v, %v", n, ok)
+	}
+}
+
 func TestAt(t *testing.T) {
 	l1 := List(1, 2, 3)
 	s := l1.ToSlice()
 	for k, v := range s {
-		if w := l1.At(uint(k)); v != w {
+		if w, err := l1.At(uint(k)); v != w || err != nil {
 			t.Errorf("At(%v, %v) != s[%v]", l1, k, k)
 		}
 	}
+	if w, err := l1.At(3); w != nil || err != ErrIndexOutOfRange {
+		t.Errorf("At(%v, 3) = %v, %v", l1, w, err)
+	}
+	if w, err := l1.At(10); w != nil || err != ErrIndexOutOfRange {
+		t.Errorf("At(%v, 10) = %v, %v", l1, w, err)
+	}
+	if w, err := L().At(0); w != nil || err != ErrIndexOutOfRange {
+		t.Errorf("At(L(), 0) = %v, %v", w, err)
+	}
 }
 
 func TestTake(t *testing.T) {
@@ -244,6 +424,12 @@ func TestMax(t *testing.T) {
 	if l := L([]int{1, 2, 3}, 3, 5, 4, 2); l.Max() != nil {
 		t.Errorf("%v", l.Max())
 	}
+	if l := L("banana", "apple", "cherry", "cherry"); l.Max() != "cherry" {
+		t.Errorf("%v", l.Max())
+	}
+	if l := L("apple"); l.Max() != "apple" {
+		t.Errorf("%v", l.Max())
+	}
 }
 
 func TestMin(t *testing.T) {
@@ -256,6 +442,12 @@ func TestMin(t *testing.T) {
 	if l := L([]int{1, 2, 3}, 3, 5, 4, 2); l.Min() != nil {
 		t.Errorf("%v", l.Min())
 	}
+	if l := L("banana", "apple", "cherry", "apple"); l.Min() != "apple" {
+		t.Errorf("%v", l.Min())
+	}
+	if l := L("apple"); l.Min() != "apple" {
+		t.Errorf("%v", l.Min())
+	}
 }
 
 func TestTakeWhile(t *testing.T) {
@@ -300,10 +492,27 @@ func TestReverse(t *testing.T) {
 	}
 }
 
+func TestReverseLong(t *testing.T) {
+	l := prog.Take(10000)
+	r := l.Reverse()
+	if r.Length() != 10000 || !r.Reverse().Equals(l) {
+		t.Error()
+	}
+	if x, _ := r.At(0); x != 10000 {
+		t.Errorf("%v", x)
+	}
+	if x, _ := r.At(9999); x != 1 {
+		t.Errorf("%v", x)
+	}
+}
+
 func TestLast(t *testing.T) {
 	if L(1, 2, 3, 4, 5).Last() != 5 {
 		t.Error()
 	}
+	if L("a").Last() != "a" || L().Last() != nil {
+		t.Error()
+	}
 }
 
 func TestUpdating(t *testing.T) {
@@ -315,6 +524,18 @@ func TestUpdating(t *testing.T) {
 	}
 }
 
+func TestIterate(t *testing.T) {
+	naturals := Iterate(func(x I) I {
+		return x.(int) + 1
+	}, 1)
+	if l := L(1, 2, 3, 4, 5); !l.Equals(naturals.Take(5)) {
+		t.Errorf("%v", naturals.Take(5))
+	}
+	if !naturals.Take(20).Equals(prog.Take(20)) {
+		t.Error()
+	}
+}
+
 func TestCurry(t *testing.T) {
 	add := func(a, b int) int {
 		return a + b
@@ -342,150 +563,2328 @@ func TestFibo(t *testing.T) {
 	}
 }
 
-func usualFibo(n int) int {
-	if n <= 1 {
-		return 1
+type gobPoint struct {
+	X, Y int
+}
+
+func TestGob(t *testing.T) {
+	gob.Register(0)
+	gob.Register("")
+	gob.Register(gobPoint{})
+	l := L(1, "a", 2, "b", gobPoint{3, 4})
+	data, err := l.GobEncode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := FromGob(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !l.Equals(r) {
+		t.Errorf("%v != %v", r, l)
+	}
+	data, err = L().GobEncode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, err := FromGob(data); err != nil || !r.Equals(L()) {
+		t.Errorf("%v, %v", r, err)
+	}
+	if _, err := FromGob([]byte("garbage")); err == nil {
+		t.Error()
+	}
+	data, _ = L(5).GobEncode()
+	if err := L().GobDecode(data); err == nil {
+		t.Errorf("GobDecode into L() didn't fail")
+	}
+	if n := L(5).Length(); n != 1 {
+		t.Errorf("%v", n)
+	}
+	var holder struct{ List *Thunk }
+	holder.List = L(1, 2)
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(holder); err != nil {
+		t.Fatal(err)
+	}
+	holder.List = nil
+	if err := gob.NewDecoder(&buf).Decode(&holder); err != nil || !holder.List.Equals(L(1, 2)) {
+		t.Errorf("%v, %v", holder.List, err)
 	}
-	return usualFibo(n-1) + usualFibo(n-2)
 }
 
-func BenchmarkIterSlice(b *testing.B) {
-	b.StopTimer()
-	s := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10,
-		11, 12, 13, 14, 15, 16, 17, 18, 19, 20}
-	b.StartTimer()
-	for i := 0; i < b.N; i++ {
-		for _ = range s {
-		}
+func TestMaterialize(t *testing.T) {
+	runs := 0
+	var gen func(int) *Thunk
+	gen = func(n int) *Thunk {
+		return MakeThunk(func() *Pair {
+			runs++
+			if n > 5 {
+				return nil
+			}
+			return &Pair{n, gen(n + 1)}
+		})
+	}
+	s, n := gen(1).Materialize()
+	if n != 5 || runs != 6 {
+		t.Errorf("%v, %v", n, runs)
+	}
+	StopMemo()
+	for i := 0; i < 3; i++ {
+		s.Length()
+		s.At(2)
+		s.Reverse().Length()
+	}
+	StartMemo()
+	if l := L(1, 2, 3, 4, 5); !l.Equals(s) || runs != 6 {
+		t.Errorf("%v, %v", s, runs)
+	}
+	if s, n := L().Materialize(); n != 0 || !s.Equals(L()) {
+		t.Error()
 	}
 }
 
-func BenchmarkIterList(b *testing.B) {
-	b.StopTimer()
-	l := L(1, 2, 3, 4, 5, 6, 7, 8, 9, 10,
-		11, 12, 13, 14, 15, 16, 17, 18, 19, 20)
-	b.StartTimer()
-	for i := 0; i < b.N; i++ {
-		for _ = range l.Iter() {
-		}
+func TestCumDistinct(t *testing.T) {
+	if l := L(1, 2, 2, 3); !l.Equals(L(1, 2, 1, 3).CumDistinct()) {
+		t.Errorf("%v", L(1, 2, 1, 3).CumDistinct())
+	}
+	l := L(3, "a", 3, 1, "a", 2, 1, 4)
+	seen := map[I]bool{}
+	expected := []I{}
+	for x := range l.Iter() {
+		seen[x] = true
+		expected = append(expected, len(seen))
+	}
+	if c := l.CumDistinct(); !c.Equals(SliceToList(expected)) {
+		t.Errorf("%v != %v", c, expected)
+	}
+	mod3 := prog.Map(func(x I) I {
+		return x.(int) % 3
+	})
+	if l := L(1, 2, 3, 3, 3); !l.Equals(mod3.CumDistinct().Take(5)) {
+		t.Errorf("%v", mod3.CumDistinct().Take(5))
+	}
+	if !L().CumDistinct().Equals(L()) {
+		t.Error()
 	}
 }
 
-func BenchmarkIterListNoMemo(b *testing.B) {
-	b.StopTimer()
-	StopMemo()
-	l := L(1, 2, 3, 4, 5, 6, 7, 8, 9, 10,
-		11, 12, 13, 14, 15, 16, 17, 18, 19, 20)
-	b.StartTimer()
-	for i := 0; i < b.N; i++ {
-		for _ = range l.Iter() {
-		}
+func TestZipWith3(t *testing.T) {
+	f := func(n int, s string, x float64) string {
+		return fmt.Sprintf("%d%s%.1f", n, s, x)
+	}
+	a, b, c := prog, L("a", "b", "c"), L(0.5, 1.5, 2.5, 3.5)
+	z := ZipWith3(a, b, c, f)
+	if l := L("1a0.5", "2b1.5", "3c2.5"); !l.Equals(z) {
+		t.Errorf("%v", z)
+	}
+	m := MapN(func(xs ...I) I {
+		return f(xs[0].(int), xs[1].(string), xs[2].(float64))
+	}, a, b, c)
+	if !m.Equals(z) {
+		t.Errorf("%v != %v", z, m)
 	}
-	StartMemo()
 }
 
-func BenchmarkMapLoop(b *testing.B) {
-	b.StopTimer()
-	s := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10,
-		11, 12, 13, 14, 15, 16, 17, 18, 19, 20}
-	double := func(n int) int {
-		return n * 2
+func TestDecompose(t *testing.T) {
+	if h, tl, ok := L().Decompose(); ok || h != nil || tl != nil {
+		t.Errorf("%v, %v, %v", h, tl, ok)
 	}
-	b.StartTimer()
-	for i := 0; i < b.N; i++ {
-		for k, v := range s {
-			s[k] = double(v)
+	if h, tl, ok := L(1).Decompose(); !ok || h != 1 || len(tl) != 0 {
+		t.Errorf("%v, %v, %v", h, tl, ok)
+	}
+	h, tl, ok := L(1, "a", 3).Decompose()
+	if !ok || h != 1 || !reflect.DeepEqual(tl, []I{"a", 3}) {
+		t.Errorf("%v, %v, %v", h, tl, ok)
+	}
+}
+
+func TestFilterMemo(t *testing.T) {
+	calls := map[I]int{}
+	odd := func(x I) bool {
+		calls[x]++
+		return x.(int)%2 == 1
+	}
+	r := L(1, 2, 1, 3, 2, 1, 3, 4).FilterMemo(odd)
+	if l := L(1, 1, 3, 1, 3); !l.Equals(r) {
+		t.Errorf("%v", r)
+	}
+	if len(calls) != 4 {
+		t.Errorf("%v", calls)
+	}
+	for x, n := range calls {
+		if n != 1 {
+			t.Errorf("f(%v) called %v times", x, n)
 		}
-		_ = s[0]
+	}
+
+	StopMemo()
+	defer StartMemo()
+	calls = map[I]int{}
+	r = L(1, 2, 1, 3, 2, 1, 3, 4).FilterMemo(odd)
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if n := r.Length(); n != 5 {
+				t.Errorf("Length() -> %v", n)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(calls) != 4 || calls[1] != 1 || calls[4] != 1 {
+		t.Errorf("%v", calls)
 	}
 }
 
-func BenchmarkMapList(b *testing.B) {
-	b.StopTimer()
-	l := L(1, 2, 3, 4, 5, 6, 7, 8, 9, 10,
-		11, 12, 13, 14, 15, 16, 17, 18, 19, 20)
-	double := func(n I) I {
-		return n.(int) * 2
+func intLess(a, b I) bool {
+	return a.(int) < b.(int)
+}
+
+func TestMergeN(t *testing.T) {
+	m := MergeN(intLess, L(1, 4, 7, 7), L(), L(2, 3, 5, 8), L(0, 7))
+	if l := L(0, 1, 2, 3, 4, 5, 7, 7, 7, 8); !l.Equals(m) {
+		t.Errorf("%v", m)
 	}
-	b.StartTimer()
-	for i := 0; i < b.N; i++ {
-		_ = l.Map(double).At(0)
+	step := func(start, n int) *Thunk {
+		return Updating(start, func(x I) I {
+			return x.(int) + n
+		})
+	}
+	m = MergeN(intLess, step(0, 3), step(1, 5), step(2, 4))
+	if l := L(0, 1, 2, 3, 6, 6, 6, 9, 10, 11); !l.Equals(m.Take(10)) {
+		t.Errorf("%v", m.Take(10))
+	}
+	if !MergeN(intLess).Equals(L()) {
+		t.Error()
 	}
 }
 
-func BenchmarkMapListNoMemo(b *testing.B) {
-	b.StopTimer()
-	StopMemo()
-	l := L(1, 2, 3, 4, 5, 6, 7, 8, 9, 10,
-		11, 12, 13, 14, 15, 16, 17, 18, 19, 20)
-	double := func(n I) I {
-		return n.(int) * 2
+func TestApplyN(t *testing.T) {
+	double := func(x I) I {
+		return x.(int) * 2
 	}
-	b.StartTimer()
-	for i := 0; i < b.N; i++ {
-		_ = l.Map(double).At(0)
+	for _, n := range []uint{0, 1, 10} {
+		if e, _ := Updating(3, double).At(n); ApplyN(n, double, 3) != e {
+			t.Errorf("ApplyN(%v) = %v != %v", n, ApplyN(n, double, 3), e)
+		}
+	}
+	if ApplyN(0, double, "x") != "x" {
+		t.Error()
 	}
-	StartMemo()
 }
 
-func BenchmarkAppendSlices(b *testing.B) {
-	b.StopTimer()
-	s := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10,
-		11, 12, 13, 14, 15, 16, 17, 18, 19, 20}
-	b.StartTimer()
-	for i := 0; i < b.N; i++ {
-		_ = append(s, s...)
+func TestStats(t *testing.T) {
+	l := L(3, 1, 4, 1, 5, 9, 2, 6)
+	min, max, mean, n, ok := l.Stats()
+	if !ok || min != float64(l.Min().(int)) || max != float64(l.Max().(int)) ||
+		mean != 31.0/8 || n != l.Length() {
+		t.Errorf("%v, %v, %v, %v, %v", min, max, mean, n, ok)
+	}
+	min, max, mean, n, ok = L(2.5, -1.0, 0.5).Stats()
+	if !ok || min != -1 || max != 2.5 || mean != 2.0/3 || n != 3 {
+		t.Errorf("%v, %v, %v, %v, %v", min, max, mean, n, ok)
+	}
+	if _, _, _, _, ok := L().Stats(); ok {
+		t.Error()
+	}
+	if _, _, _, _, ok := L(1, "a", 3).Stats(); ok {
+		t.Error()
 	}
 }
 
-func BenchmarkAppendLists(b *testing.B) {
-	l := L(1, 2, 3, 4, 5, 6, 7, 8, 9, 10,
-		11, 12, 13, 14, 15, 16, 17, 18, 19, 20)
-	b.StartTimer()
-	for i := 0; i < b.N; i++ {
-		_ = l.Append(l)
+func TestTakeWhileIndexed(t *testing.T) {
+	squares := prog.Map(func(x I) I {
+		return x.(int) * x.(int)
+	})
+	lt := func(i int, x I) bool {
+		return x.(int) < 2*(i+10)
+	}
+	expected := []I{}
+	for i, x := range squares.Take(100).ToSlice() {
+		if !lt(i, x) {
+			break
+		}
+		expected = append(expected, x)
+	}
+	if r := squares.TakeWhileIndexed(lt); !r.Equals(SliceToList(expected)) {
+		t.Errorf("%v != %v", r, expected)
+	}
+	if !L().TakeWhileIndexed(lt).Equals(L()) {
+		t.Error()
 	}
 }
 
-func BenchmarkAppendLsNoMemo(b *testing.B) {
-	b.StopTimer()
-	StopMemo()
-	l := L(1, 2, 3, 4, 5, 6, 7, 8, 9, 10,
-		11, 12, 13, 14, 15, 16, 17, 18, 19, 20)
-	b.StartTimer()
-	for i := 0; i < b.N; i++ {
-		_ = l.Append(l)
+func TestTransitions(t *testing.T) {
+	if l := L(L(1, 2), L(2, 3), L(3, 1)); !l.Equals(L(1, 1, 2, 2, 3, 1).Transitions()) {
+		t.Errorf("%v", L(1, 1, 2, 2, 3, 1).Transitions())
+	}
+	if !L(4, 4, 4, 4).Transitions().Equals(L()) || !L().Transitions().Equals(L()) {
+		t.Error()
+	}
+	alternating := Updating(0, func(x I) I {
+		return 1 - x.(int)
+	})
+	if l := L(L(0, 1), L(1, 0), L(0, 1)); !l.Equals(alternating.Transitions().Take(3)) {
+		t.Errorf("%v", alternating.Transitions().Take(3))
 	}
-	StartMemo()
 }
 
-func BenchmarkUsualFibo(b *testing.B) {
-	for i := 0; i < b.N; i++ {
-		usualFibo(30)
+func TestWriteJSONLines(t *testing.T) {
+	l := L(map[string]I{"a": 1.0}, map[string]I{"b": "x"}, map[string]I{})
+	var buf bytes.Buffer
+	if err := l.WriteJSONLines(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var got []I
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var m map[string]I
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, m)
+	}
+	if !reflect.DeepEqual(got, l.ToSlice()) {
+		t.Errorf("%v", got)
+	}
+	buf.Reset()
+	if err := L(1, make(chan int), 3).WriteJSONLines(&buf); err == nil || buf.String() != "1\n" {
+		t.Errorf("%v, %q", err, buf.String())
 	}
 }
 
-func BenchmarkFiboStream(b *testing.B) {
-	for i := 0; i < b.N; i++ {
-		_ = fibo.At(30)
+func TestFromJSONLines(t *testing.T) {
+	r := strings.NewReader(`{"a": 1}
+
+{"b": "x"}
+{"c": [true]}`)
+	l := FromJSONLines(r)
+	expected := L(map[string]interface{}{"a": 1}, map[string]interface{}{"b": "x"},
+		map[string]interface{}{"c": []interface{}{true}})
+	if s := l.ToSlice(); !reflect.DeepEqual(s, expected.ToSlice()) {
+		t.Errorf("%v", s)
+	}
+	if l.Length() != 3 {
+		t.Error()
+	}
+	l = FromJSONLines(strings.NewReader("1\n{oops\n3\n"))
+	if l.Length() != 2 || l.Head() != 1 {
+		t.Errorf("%v", l)
+	}
+	if _, ok := l.Tail().Head().(error); !ok {
+		t.Errorf("%v", l)
+	}
+	l = FromJSONLines(strings.NewReader("[1.5, 2]\n1 2\n"))
+	if s := l.ToSlice(); len(s) != 2 || !reflect.DeepEqual(s[0], []interface{}{1.5, 2}) {
+		t.Errorf("%v", s)
+	} else if _, ok := s[1].(error); !ok {
+		t.Errorf("%v", s)
+	}
+	boom := errors.New("boom")
+	l = FromJSONLines(io.MultiReader(strings.NewReader("{\"a\": 1}\n{\"b\""), iotest.ErrReader(boom)))
+	s := l.ToSlice()
+	if len(s) != 2 || !reflect.DeepEqual(s[0], map[string]interface{}{"a": 1}) {
+		t.Fatalf("%v", s)
+	}
+	if err, ok := s[1].(error); !ok || !errors.Is(err, boom) || !strings.Contains(err.Error(), `{\"b\"`) {
+		t.Errorf("%v", s[1])
 	}
 }
 
-func BenchmarkFiboStrNoMemo(b *testing.B) {
-	b.StopTimer()
-	StopMemo()
-	fibo = Link(1, DelayedLink(1, func() *Thunk {
-		return MapN(func(xs ...I) I {
-			ret := 0
-			for _, v := range xs {
-				ret += v.(int)
-			}
-			return ret
-		}, fibo, fibo.Tail())
-	}))
-	b.StartTimer()
-	for i := 0; i < b.N; i++ {
-		_ = fibo.At(30)
+func TestWindowedReduce(t *testing.T) {
+	sum := func(xs ...I) I {
+		ret := 0
+		for _, x := range xs {
+			ret += x.(int)
+		}
+		return ret
+	}
+	l := L(1, 2, 3, 4, 5, 6, 7)
+	if r := l.WindowedReduce(3, 1, sum); !r.Equals(L(6, 9, 12, 15, 18)) {
+		t.Errorf("%v", r)
+	}
+	if r := l.WindowedReduce(3, 2, sum); !r.Equals(L(6, 12, 18)) {
+		t.Errorf("%v", r)
+	}
+	if r := l.WindowedReduce(2, 2, sum); !r.Equals(L(3, 7, 11)) {
+		t.Errorf("%v", r)
+	}
+	if r := l.WindowedReduce(1, 3, sum); !r.Equals(L(1, 4, 7)) {
+		t.Errorf("%v", r)
+	}
+	if r := prog.WindowedReduce(2, 2, sum).Take(3); !r.Equals(L(3, 7, 11)) {
+		t.Errorf("%v", r)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error()
+		}
+	}()
+	l.WindowedReduce(0, 1, sum)
+}
+
+func TestSelectModulo(t *testing.T) {
+	l := L(0, 1, 2, 3, 4, 5, 6, 7)
+	for r, e := range []*Thunk{L(0, 3, 6), L(1, 4, 7), L(2, 5)} {
+		if s := l.SelectModulo(3, uint(r)); !s.Equals(e) {
+			t.Errorf("SelectModulo(3, %v) = %v", r, s)
+		}
+	}
+	if !l.SelectModulo(1, 0).Equals(l) || !L().SelectModulo(2, 1).Equals(L()) {
+		t.Error()
+	}
+	if s := prog.SelectModulo(4, 3).Take(3); !s.Equals(L(4, 8, 12)) {
+		t.Errorf("%v", s)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error()
+		}
+	}()
+	l.SelectModulo(0, 0)
+}
+
+func TestFlattenWithDepth(t *testing.T) {
+	if l := L(L(0, 1), L(1, 2), L(2, 3)); !l.Equals(L(1, L(2, L(3))).FlattenWithDepth()) {
+		t.Errorf("%v", L(1, L(2, L(3))).FlattenWithDepth())
+	}
+	nested := L(L(L("a"), "b"), L(), "c", L(L(), L(L("d"))), "e")
+	l := L(L(2, "a"), L(1, "b"), L(0, "c"), L(3, "d"), L(0, "e"))
+	if f := nested.FlattenWithDepth(); !l.Equals(f) {
+		t.Errorf("%v", f)
+	}
+	if l := L(L(1, 1), L(1, 2)); !l.Equals(L(prog).FlattenWithDepth().Take(2)) {
+		t.Errorf("%v", L(prog).FlattenWithDepth().Take(2))
+	}
+}
+
+func TestRunStateMachine(t *testing.T) {
+	var chars []rune
+	for _, c := range "go is  fun." {
+		chars = append(chars, c)
+	}
+	tokenize := func(word string, c rune) (string, string) {
+		if c == ' ' || c == '.' {
+			return "", word
+		}
+		return word + string(c), ""
+	}
+	tokens := RunStateMachine(SliceToList(chars), "", tokenize).Filter(func(x I) bool {
+		return x.(string) != ""
+	})
+	if l := L("go", "is", "fun"); !l.Equals(tokens) {
+		t.Errorf("%v", tokens)
+	}
+	count := func(n int, x int) (int, int) {
+		return n + x, n + x
+	}
+	if l := L(1, 3, 6); !l.Equals(RunStateMachine(prog, 0, count).Take(3)) {
+		t.Errorf("%v", RunStateMachine(prog, 0, count).Take(3))
+	}
+}
+
+func TestSuppressRepeats(t *testing.T) {
+	l := L(1, 1, 2, 3, 3, 3, 1, 4, 4, 4, 4)
+	for minRun, e := range map[uint]*Thunk{
+		0: L(1, 2, 3, 1, 4),
+		2: L(1, 2, 3, 1, 4),
+		3: L(1, 1, 2, 3, 1, 4),
+		4: L(1, 1, 2, 3, 3, 3, 1, 4),
+		5: l,
+	} {
+		if s := l.SuppressRepeats(minRun); !s.Equals(e) {
+			t.Errorf("SuppressRepeats(%v) = %v", minRun, s)
+		}
+	}
+	if !L().SuppressRepeats(2).Equals(L()) {
+		t.Error()
+	}
+}
+
+func TestZipLongestWith(t *testing.T) {
+	list := func(xs ...I) I {
+		return L(xs...)
+	}
+	z := ZipLongestWith(list, []I{0, "-", 0.5}, L(1, 2), L("a", "b", "c", "d"), L(1.5))
+	l := L(L(1, "a", 1.5), L(2, "b", 0.5), L(0, "c", 0.5), L(0, "d", 0.5))
+	if !l.Equals(z) {
+		t.Errorf("%v", z)
+	}
+	if z := ZipLongestWith(list, []I{0, 0}, L(), L()); !z.Equals(L()) {
+		t.Errorf("%v", z)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error()
+		}
+	}()
+	ZipLongestWith(list, []I{0}, L(1), L(2))
+}
+
+func concatStrings(acc, x I) I {
+	return acc.(string) + x.(string)
+}
+
+func TestParFoldTree(t *testing.T) {
+	words := prog.Take(5000).Map(func(x I) I {
+		return fmt.Sprint(x, ",")
+	})
+	expected := words.Reduce(concatStrings, "")
+	for _, workers := range []int{0, 1, 3, 8, 10000} {
+		if r := words.ParFoldTree(concatStrings, "", workers); r != expected {
+			t.Errorf("ParFoldTree with %v workers = %.40v...", workers, r)
+		}
+	}
+	if r := L().ParFoldTree(concatStrings, "", 4); r != "" {
+		t.Errorf("%v", r)
+	}
+}
+
+func TestFind(t *testing.T) {
+	gt2 := func(x I) bool {
+		return x.(int) > 2
+	}
+	if x, ok := L(1, 2, 3, 4).Find(gt2); !ok || x != 3 {
+		t.Errorf("%v, %v", x, ok)
+	}
+	if x, ok := L(1, 2).Find(gt2); ok || x != nil {
+		t.Errorf("%v, %v", x, ok)
+	}
+	if x, ok := L().Find(gt2); ok || x != nil {
+		t.Errorf("%v, %v", x, ok)
+	}
+	squares := Updating(1, func(x I) I {
+		return x.(int) + 1
+	}).Map(func(x I) I {
+		return x.(int) * x.(int)
+	})
+	if x, ok := squares.Find(func(x I) bool { return x.(int) > 50 }); !ok || x != 64 {
+		t.Errorf("%v, %v", x, ok)
+	}
+}
+
+func TestFindIndex(t *testing.T) {
+	even := func(x I) bool {
+		return x.(int)%2 == 0
+	}
+	if i, ok := L(2, 3).FindIndex(even); !ok || i != 0 {
+		t.Errorf("%v, %v", i, ok)
+	}
+	if i, ok := L(1, 3, 5, 6, 8).FindIndex(even); !ok || i != 3 {
+		t.Errorf("%v, %v", i, ok)
+	}
+	if i, ok := L(1, 3, 5).FindIndex(even); ok || i != -1 {
+		t.Errorf("%v, %v", i, ok)
+	}
+	forced := 0
+	counted := prog.Map(func(x I) I {
+		forced++
+		return x
+	})
+	if i, ok := counted.FindIndex(func(x I) bool { return x.(int) == 7 }); !ok || i != 6 || forced != 7 {
+		t.Errorf("%v, %v, %v", i, ok, forced)
+	}
+}
+
+func TestFirstNLastN(t *testing.T) {
+	l := L(1, 2, 3, 4, 5)
+	if s := l.FirstN(2); !reflect.DeepEqual(s, []I{1, 2}) {
+		t.Errorf("%v", s)
+	}
+	if s := prog.FirstN(3); !reflect.DeepEqual(s, []I{1, 2, 3}) {
+		t.Errorf("%v", s)
+	}
+	if s := l.FirstN(10); !reflect.DeepEqual(s, l.ToSlice()) {
+		t.Errorf("%v", s)
+	}
+	if s := l.LastN(2); !reflect.DeepEqual(s, []I{4, 5}) {
+		t.Errorf("%v", s)
+	}
+	if s := l.LastN(10); !reflect.DeepEqual(s, l.ToSlice()) {
+		t.Errorf("%v", s)
+	}
+	if s := l.LastN(0); len(s) != 0 {
+		t.Errorf("%v", s)
+	}
+	if s := L().LastN(3); len(s) != 0 {
+		t.Errorf("%v", s)
+	}
+}
+
+func TestMonotonicRuns(t *testing.T) {
+	r := L(1, 3, 2, 2, 5, 4).MonotonicRuns(intLess)
+	if l := L(L(1, 3), L(2, 2, 5), L(4)); !l.Equals(r) {
+		t.Errorf("%v", r)
+	}
+	r = L(9, 7, 5, 6, 7, 8, 3, 1, 2).MonotonicRuns(intLess)
+	if l := L(L(9), L(7), L(5, 6, 7, 8), L(3), L(1, 2)); !l.Equals(r) {
+		t.Errorf("%v", r)
+	}
+	if !L().MonotonicRuns(intLess).Equals(L()) {
+		t.Error()
+	}
+	saw := prog.Map(func(x I) I {
+		return x.(int) % 3
+	})
+	if l := L(L(1, 2), L(0, 1, 2)); !l.Equals(saw.MonotonicRuns(intLess).Take(2)) {
+		t.Errorf("%v", saw.MonotonicRuns(intLess).Take(2))
+	}
+}
+
+func TestCount(t *testing.T) {
+	even := func(x I) bool {
+		return x.(int)%2 == 0
+	}
+	l := prog.Take(15)
+	r := l.Reduce(func(acc, x I) I {
+		if even(x) {
+			return acc.(int) + 1
+		}
+		return acc
+	}, 0)
+	if c := l.Count(even); c != r || c != 7 {
+		t.Errorf("%v != %v", c, r)
+	}
+	if c := L().Count(even); c != 0 {
+		t.Errorf("%v", c)
+	}
+}
+
+func TestFlatMap(t *testing.T) {
+	twice := func(x I) *Thunk {
+		return L(x, x)
+	}
+	if l := L(1, 1, 2, 2, 3, 3); !l.Equals(L(1, 2, 3).FlatMap(twice)) {
+		t.Errorf("%v", L(1, 2, 3).FlatMap(twice))
+	}
+	upTo := func(x I) *Thunk {
+		return prog.Take(uint(x.(int)))
+	}
+	if l := L(1, 1, 2, 1, 2, 3); !l.Equals(L(0, 1, 0, 2, 0, 0, 3, 0).FlatMap(upTo)) {
+		t.Errorf("%v", L(0, 1, 0, 2, 0, 0, 3, 0).FlatMap(upTo))
+	}
+	if !L(0, 0).FlatMap(upTo).Equals(L()) || !L().FlatMap(twice).Equals(L()) {
+		t.Error()
+	}
+	if l := L(1, 1, 2, 1, 2, 3, 1); !l.Equals(prog.FlatMap(upTo).Take(7)) {
+		t.Errorf("%v", prog.FlatMap(upTo).Take(7))
+	}
+}
+
+func TestBufferUntil(t *testing.T) {
+	bySize := func(buffer []I, next I) bool {
+		return len(buffer) == 3
+	}
+	if l := L(L(1, 2, 3), L(4, 5, 6), L(7)); !l.Equals(prog.Take(7).BufferUntil(bySize)) {
+		t.Errorf("%v", prog.Take(7).BufferUntil(bySize))
+	}
+	if l := L(L(1, 2, 3), L(4, 5, 6)); !l.Equals(prog.BufferUntil(bySize).Take(2)) {
+		t.Errorf("%v", prog.BufferUntil(bySize).Take(2))
+	}
+	onZero := func(buffer []I, next I) bool {
+		return next == 0
+	}
+	b := L(0, 1, 2, 0, 3, 0, 0, 4).BufferUntil(onZero)
+	if l := L(L(0, 1, 2), L(0, 3), L(0), L(0, 4)); !l.Equals(b) {
+		t.Errorf("%v", b)
+	}
+	if !L().BufferUntil(onZero).Equals(L()) {
+		t.Error()
+	}
+}
+
+func TestWithMetrics(t *testing.T) {
+	w, metrics := prog.WithMetrics()
+	if f, e := metrics(); f != 0 || e != 0 {
+		t.Errorf("%v, %v", f, e)
+	}
+	w.Take(3).Length()
+	if f, e := metrics(); f != 3 || e != 3 {
+		t.Errorf("%v, %v", f, e)
+	}
+	for _ = range w.Take(5).Iter() {
+	}
+	if f, e := metrics(); f != 5 || e != 5 {
+		t.Errorf("%v, %v", f, e)
+	}
+	w, metrics = L(1, 2).WithMetrics()
+	w.Length()
+	if f, e := metrics(); f != 3 || e != 2 {
+		t.Errorf("%v, %v", f, e)
+	}
+}
+
+func TestScan(t *testing.T) {
+	sum := func(acc, x I) I {
+		return acc.(int) + x.(int)
+	}
+	if l := L(0, 1, 3, 6); !l.Equals(L(1, 2, 3).Scan(sum, 0)) {
+		t.Errorf("%v", L(1, 2, 3).Scan(sum, 0))
+	}
+	if l := L(7); !l.Equals(L().Scan(sum, 7)) {
+		t.Errorf("%v", L().Scan(sum, 7))
+	}
+	if l := L(0, 1, 3, 6, 10, 15); !l.Equals(prog.Scan(sum, 0).Take(6)) {
+		t.Errorf("%v", prog.Scan(sum, 0).Take(6))
+	}
+}
+
+func TestPartition(t *testing.T) {
+	even := func(x I) bool {
+		return x.(int)%2 == 0
+	}
+	l := L(1, 2, 4, 3, 5, 6, 8, 7)
+	p, f := l.Partition(even)
+	if !p.Equals(L(2, 4, 6, 8)) || !f.Equals(L(1, 3, 5, 7)) {
+		t.Errorf("%v, %v", p, f)
+	}
+	var merged []I
+	for x := range l.Iter() {
+		if even(x) {
+			merged = append(merged, p.Head())
+			p = p.Tail()
+		} else {
+			merged = append(merged, f.Head())
+			f = f.Tail()
+		}
+	}
+	if !l.Equals(List(merged...)) {
+		t.Errorf("%v", merged)
+	}
+	if p, f := L().Partition(even); !p.Equals(L()) || !f.Equals(L()) {
+		t.Errorf("%v, %v", p, f)
+	}
+}
+
+func TestShard(t *testing.T) {
+	l := prog.Take(12)
+	shards := l.Shard(3)
+	if len(shards) != 3 || !shards[1].Equals(L(2, 5, 8, 11)) {
+		t.Errorf("%v", shards)
+	}
+	if r := ZipN(shards...).Flatten(); !r.Equals(l) {
+		t.Errorf("%v", r)
+	}
+	shards = prog.Shard(2)
+	if !shards[1].Take(3).Equals(L(2, 4, 6)) || !shards[0].Take(2).Equals(L(1, 3)) {
+		t.Error()
+	}
+	if shards := L(1).Shard(2); !shards[0].Equals(L(1)) || !shards[1].Equals(L()) {
+		t.Errorf("%v", shards)
+	}
+}
+
+func intEq(a, b I) bool {
+	return a.(int) == b.(int)
+}
+
+func TestGroupBy(t *testing.T) {
+	if l := L(L(1, 1), L(2), L(3, 3, 3)); !l.Equals(L(1, 1, 2, 3, 3, 3).GroupBy(intEq)) {
+		t.Errorf("%v", L(1, 1, 2, 3, 3, 3).GroupBy(intEq))
+	}
+	if !L().GroupBy(intEq).Equals(L()) {
+		t.Error()
+	}
+	if l := L(L(1), L(2), L(3)); !l.Equals(L(1, 2, 3).GroupBy(intEq)) {
+		t.Errorf("%v", L(1, 2, 3).GroupBy(intEq))
+	}
+	if l := L(L(4, 4, 4)); !l.Equals(L(4, 4, 4).GroupBy(intEq)) {
+		t.Errorf("%v", L(4, 4, 4).GroupBy(intEq))
+	}
+	halves := prog.Map(func(x I) I {
+		return x.(int) / 2
+	})
+	if l := L(L(0), L(1, 1), L(2, 2)); !l.Equals(halves.GroupBy(intEq).Take(3)) {
+		t.Errorf("%v", halves.GroupBy(intEq).Take(3))
+	}
+}
+
+func TestExpandTree(t *testing.T) {
+	tree := map[string]*Thunk{
+		"a": L("b", "c"),
+		"b": L("d", "e"),
+		"c": L("f"),
+		"e": L("g"),
+	}
+	children := func(x I) *Thunk {
+		if c, ok := tree[x.(string)]; ok {
+			return c
+		}
+		return L()
+	}
+	if l := L("a", "b", "d", "e", "g", "c", "f"); !l.Equals(ExpandDFS("a", children)) {
+		t.Errorf("%v", ExpandDFS("a", children))
+	}
+	if l := L("a", "b", "c", "d", "e", "f", "g"); !l.Equals(ExpandBFS("a", children)) {
+		t.Errorf("%v", ExpandBFS("a", children))
+	}
+	binary := func(x I) *Thunk {
+		return L(2*x.(int), 2*x.(int)+1)
+	}
+	if l := L(1, 2, 4, 8, 16); !l.Equals(ExpandDFS(1, binary).Take(5)) {
+		t.Errorf("%v", ExpandDFS(1, binary).Take(5))
+	}
+	if l := prog.Take(20); !l.Equals(ExpandBFS(1, binary).Take(20)) {
+		t.Errorf("%v", ExpandBFS(1, binary).Take(20))
+	}
+}
+
+func TestDistinct(t *testing.T) {
+	if l := L(1, 2, 3); !l.Equals(l.Distinct()) {
+		t.Errorf("%v", l.Distinct())
+	}
+	if l := L(5); !l.Equals(L(5, 5, 5, 5).Distinct()) {
+		t.Errorf("%v", L(5, 5, 5, 5).Distinct())
+	}
+	if l := L(1, "a", 2); !l.Equals(L(1, "a", 1, "a", 2).Distinct()) {
+		t.Errorf("%v", L(1, "a", 1, "a", 2).Distinct())
+	}
+	if !L().Distinct().Equals(L()) {
+		t.Error()
+	}
+	mod4 := prog.Map(func(x I) I {
+		return x.(int) % 4
+	})
+	if l := L(1, 2, 3, 0); !l.Equals(mod4.Distinct().Take(4)) {
+		t.Errorf("%v", mod4.Distinct().Take(4))
+	}
+}
+
+func TestMemoizeLRU(t *testing.T) {
+	StopMemo()
+	defer StartMemo()
+	runs := 0
+	var gen func(int) *Thunk
+	gen = func(n int) *Thunk {
+		return MakeThunk(func() *Pair {
+			runs++
+			return &Pair{n, gen(n + 1)}
+		})
+	}
+	var evicted []I
+	l := gen(0).MemoizeLRU(3, func(x I) {
+		evicted = append(evicted, x)
+	})
+	for i := 0; i < 3; i++ {
+		if p := l.Take(3); !p.Equals(L(0, 1, 2)) {
+			t.Errorf("%v", p)
+		}
+	}
+	if runs != 3 || len(evicted) != 0 {
+		t.Errorf("%v, %v", runs, evicted)
+	}
+	if p := l.Take(5); !p.Equals(L(0, 1, 2, 3, 4)) {
+		t.Errorf("%v", p)
+	}
+	if runs != 5 || !reflect.DeepEqual(evicted, []I{0, 1}) {
+		t.Errorf("%v, %v", runs, evicted)
+	}
+	if x, _ := l.At(0); x != 0 || runs != 6 {
+		t.Errorf("%v, %v", x, runs)
+	}
+	if !panics(func() { L(1, 2, 3).MemoizeLRU(-1, nil) }) {
+		t.Errorf("MemoizeLRU(-1, nil) didn't panic")
+	}
+	if n := L(1, 2, 3).MemoizeLRU(0, nil).Length(); n != 3 {
+		t.Errorf("MemoizeLRU(0, nil).Length() -> %v", n)
+	}
+}
+
+func TestSplitAt(t *testing.T) {
+	l := L(1, 2, 3)
+	if a, b := l.SplitAt(0); !a.Equals(L()) || !b.Equals(l) {
+		t.Errorf("%v, %v", a, b)
+	}
+	if a, b := l.SplitAt(1); !a.Equals(L(1)) || !b.Equals(L(2, 3)) {
+		t.Errorf("%v, %v", a, b)
+	}
+	if a, b := l.SplitAt(3); !a.Equals(l) || !b.Equals(L()) {
+		t.Errorf("%v, %v", a, b)
+	}
+	if a, b := l.SplitAt(5); !a.Equals(l) || !b.Equals(L()) {
+		t.Errorf("%v, %v", a, b)
+	}
+	if a, b := prog.SplitAt(2); !a.Equals(L(1, 2)) || !b.Take(2).Equals(L(3, 4)) {
+		t.Errorf("%v, %v", a, b.Take(2))
+	}
+}
+
+func TestToSlice2D(t *testing.T) {
+	s, err := L(L(1, 2), L(), L("a")).ToSlice2D()
+	if err != nil || !reflect.DeepEqual(s, [][]I{{1, 2}, {}, {"a"}}) {
+		t.Errorf("%v, %v", s, err)
+	}
+	if s, err := L(L(1), 2).ToSlice2D(); err == nil || s != nil {
+		t.Errorf("%v, %v", s, err)
+	}
+	if s, err := L().ToSlice2D(); err != nil || len(s) != 0 {
+		t.Errorf("%v, %v", s, err)
+	}
+}
+
+func TestToMap(t *testing.T) {
+	m, err := L(1, 2).Zip(L("a", "b")).ToMap()
+	if err != nil || !reflect.DeepEqual(m, map[I]I{1: "a", 2: "b"}) {
+		t.Errorf("%v, %v", m, err)
+	}
+	if m, err := L().ToMap(); err != nil || len(m) != 0 {
+		t.Errorf("%v, %v", m, err)
+	}
+	if m, err := L(L("a", 1), L("a", 2)).ToMap(); err != nil || m["a"] != 2 {
+		t.Errorf("%v, %v", m, err)
+	}
+	for _, l := range []*Thunk{
+		L(L(1, 2), 3),
+		L(L(1, 2), L(3)),
+		L(L(1, 2, 3)),
+		L(L([]int{1}, 2)),
+		L(L([1]I{[]int{1}}, 2)),
+	} {
+		if m, err := l.ToMap(); err == nil {
+			t.Errorf("%v: %v", l, m)
+		}
+	}
+}
+
+func TestSpan(t *testing.T) {
+	lt3 := func(x I) bool {
+		return x.(int) < 3
+	}
+	if a, b := L(1, 2, 3, 1).Span(lt3); !a.Equals(L(1, 2)) || !b.Equals(L(3, 1)) {
+		t.Errorf("%v, %v", a, b)
+	}
+	if a, b := L(5, 1).Span(lt3); !a.Equals(L()) || !b.Equals(L(5, 1)) {
+		t.Errorf("%v, %v", a, b)
+	}
+	if a, b := L().Span(lt3); !a.Equals(L()) || !b.Equals(L()) {
+		t.Errorf("%v, %v", a, b)
+	}
+	always := func(x I) bool {
+		return true
+	}
+	if a, _ := prog.Span(always); !a.Take(4).Equals(L(1, 2, 3, 4)) {
+		t.Errorf("%v", a.Take(4))
+	}
+}
+
+func TestScanByKey(t *testing.T) {
+	type event struct {
+		key   string
+		value int
+	}
+	l := L(event{"a", 1}, event{"b", 10}, event{"a", 2}, event{"a", 3}, event{"b", 20})
+	key := func(x I) I {
+		return x.(event).key
+	}
+	sum := func(acc, x I) I {
+		return acc.(int) + x.(event).value
+	}
+	if r := l.ScanByKey(key, sum, 0); !r.Equals(L(1, 10, 3, 6, 30)) {
+		t.Errorf("%v", r)
+	}
+	parity := func(x I) I {
+		return x.(int) % 2
+	}
+	add := func(acc, x I) I {
+		return acc.(int) + x.(int)
+	}
+	if r := prog.ScanByKey(parity, add, 0).Take(6); !r.Equals(L(1, 2, 4, 6, 9, 12)) {
+		t.Errorf("%v", r)
+	}
+}
+
+func TestChunk(t *testing.T) {
+	if l := L(L(1, 2), L(3, 4)); !l.Equals(L(1, 2, 3, 4).Chunk(2)) {
+		t.Errorf("%v", L(1, 2, 3, 4).Chunk(2))
+	}
+	if l := L(L(1, 2), L(3, 4), L(5)); !l.Equals(L(1, 2, 3, 4, 5).Chunk(2)) {
+		t.Errorf("%v", L(1, 2, 3, 4, 5).Chunk(2))
+	}
+	if l := L(L(1, 2)); !l.Equals(L(1, 2).Chunk(5)) {
+		t.Errorf("%v", L(1, 2).Chunk(5))
+	}
+	if !L().Chunk(3).Equals(L()) {
+		t.Error()
+	}
+	if l := L(L(1, 2, 3), L(4, 5, 6)); !l.Equals(prog.Chunk(3).Take(2)) {
+		t.Errorf("%v", prog.Chunk(3).Take(2))
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error()
+		}
+	}()
+	L(1).Chunk(0)
+}
+
+func TestDefer(t *testing.T) {
+	runs := 0
+	var fib *Thunk
+	fib = Link(1, Link(1, Defer(func() *Thunk {
+		runs++
+		return MapN(func(xs ...I) I {
+			return xs[0].(int) + xs[1].(int)
+		}, fib, fib.Tail())
+	})))
+	if runs != 0 {
+		t.Error()
+	}
+	if l := L(1, 1, 2, 3, 5, 8); !l.Equals(fib.Take(6)) {
+		t.Errorf("%v", fib.Take(6))
+	}
+	fib.Take(10).Length()
+	if runs != 1 {
+		t.Errorf("%v", runs)
+	}
+}
+
+func TestParReduceByKey(t *testing.T) {
+	category := func(x I) I {
+		return x.(int) % 5
+	}
+	add := func(a, b I) I {
+		return a.(int) + b.(int)
+	}
+	l := prog.Take(1000)
+	expected := map[I]I{}
+	for x := range l.Iter() {
+		k := category(x)
+		if acc, ok := expected[k]; ok {
+			expected[k] = add(acc, x)
+		} else {
+			expected[k] = x
+		}
+	}
+	for _, workers := range []int{0, 1, 3} {
+		got := map[I]I{}
+		for kv := range l.ParReduceByKey(category, add, workers).Iter() {
+			got[kv.(*Thunk).Head()] = kv.(*Thunk).Tail().Head()
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("%v workers: %v != %v", workers, got, expected)
+		}
+	}
+	if !L().ParReduceByKey(category, add, 2).Equals(L()) {
+		t.Error()
+	}
+}
+
+func TestWindows(t *testing.T) {
+	if l := L(L(1, 2), L(2, 3), L(3, 4)); !l.Equals(L(1, 2, 3, 4).Windows(2)) {
+		t.Errorf("%v", L(1, 2, 3, 4).Windows(2))
+	}
+	if l := L(L(1), L(2)); !l.Equals(L(1, 2).Windows(1)) {
+		t.Errorf("%v", L(1, 2).Windows(1))
+	}
+	if !L(1, 2).Windows(3).Equals(L()) || !L().Windows(1).Equals(L()) {
+		t.Error()
+	}
+	if l := L(L(1, 2, 3), L(2, 3, 4)); !l.Equals(prog.Windows(3).Take(2)) {
+		t.Errorf("%v", prog.Windows(3).Take(2))
+	}
+}
+
+func TestDistinctWithin(t *testing.T) {
+	l := L(1, 2, 1, 3, 4, 1, 1)
+	if d := l.DistinctWithin(2); !d.Equals(L(1, 2, 3, 4, 1)) {
+		t.Errorf("%v", d)
+	}
+	if d := l.DistinctWithin(3); !d.Equals(L(1, 2, 3, 4)) {
+		t.Errorf("%v", d)
+	}
+	if d := l.DistinctWithin(1); !d.Equals(L(1, 2, 1, 3, 4, 1)) {
+		t.Errorf("%v", d)
+	}
+	if d := l.DistinctWithin(0); !d.Equals(l) {
+		t.Errorf("%v", d)
+	}
+	mod3 := prog.Map(func(x I) I {
+		return x.(int) % 3
+	})
+	if d := mod3.DistinctWithin(2).Take(4); !d.Equals(L(1, 2, 0, 1)) {
+		t.Errorf("%v", d)
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	r := L(1, 2, 3).RoundRobin(L("a"), L(), L(true, false))
+	if l := L(1, "a", true, 2, false, 3); !l.Equals(r) {
+		t.Errorf("%v", r)
+	}
+	r = L("a", "b").RoundRobin(prog, L(0.5))
+	if l := L("a", 1, 0.5, "b", 2, 3, 4); !l.Equals(r.Take(7)) {
+		t.Errorf("%v", r.Take(7))
+	}
+	if !L().RoundRobin().Equals(L()) || !L().RoundRobin(L(), L()).Equals(L()) {
+		t.Error()
+	}
+}
+
+func TestConcat(t *testing.T) {
+	if !Concat().Equals(L()) {
+		t.Error()
+	}
+	if l := L(1, 2); !l.Equals(Concat(l)) {
+		t.Errorf("%v", Concat(l))
+	}
+	c := Concat(L(), L(1, 2), L(), L(), L(3), L(4, 5), L())
+	if l := L(1, 2, 3, 4, 5); !l.Equals(c) {
+		t.Errorf("%v", c)
+	}
+	if l := L(1, 2, 1, 2); !l.Equals(Concat(L(1), L(), L(2), prog).Take(4)) {
+		t.Errorf("%v", Concat(L(1), L(), L(2), prog).Take(4))
+	}
+}
+
+func TestConcatAll(t *testing.T) {
+	if !ConcatAll(L()).Equals(L()) {
+		t.Errorf("%v", ConcatAll(L()))
+	}
+	c := ConcatAll(L(L(), L(1, 2), L(), L(3), L(4, 5), L()))
+	if !c.Equals(L(1, 2, 3, 4, 5)) {
+		t.Errorf("%v", c)
+	}
+	if l := ConcatAll(prog.Map(func(x I) I { return L(x, x) })).Take(5); !l.Equals(L(1, 1, 2, 2, 3)) {
+		t.Errorf("%v", l)
+	}
+	StopMemo()
+	defer StartMemo()
+	lists := make([]*Thunk, 1000)
+	for i := range lists {
+		lists[i] = L(i, i)
+	}
+	all := ConcatAll(SliceToList(lists))
+	if n, x := all.Length(), all.Last(); n != 2000 || x != 999 {
+		t.Errorf("%v, %v", n, x)
+	}
+}
+
+func TestZipWith(t *testing.T) {
+	add := func(a, b I) I {
+		return a.(int) + b.(int)
+	}
+	if l := L(11, 22, 33); !l.Equals(L(1, 2, 3).ZipWith(L(10, 20, 30), add)) {
+		t.Errorf("%v", L(1, 2, 3).ZipWith(L(10, 20, 30), add))
+	}
+	if l := L(11, 22); !l.Equals(L(1, 2, 3).ZipWith(L(10, 20), add)) {
+		t.Errorf("%v", L(1, 2, 3).ZipWith(L(10, 20), add))
+	}
+	if l := L(2, 3, 5, 8, 13); !l.Equals(fibo.ZipWith(fibo.Tail(), add).Take(5)) {
+		t.Errorf("%v", fibo.ZipWith(fibo.Tail(), add).Take(5))
+	}
+}
+
+func TestCycle(t *testing.T) {
+	if l := L(1, 2, 3, 1, 2, 3, 1); !l.Equals(L(1, 2, 3).Cycle().Take(7)) {
+		t.Errorf("%v", L(1, 2, 3).Cycle().Take(7))
+	}
+	if l := L(4, 4, 4); !l.Equals(L(4).Cycle().Take(3)) {
+		t.Errorf("%v", L(4).Cycle().Take(3))
+	}
+	if !L().Cycle().Equals(L()) {
+		t.Error()
+	}
+	if x, _ := L(1, 2, 3).Cycle().At(100000); x != 2 {
+		t.Errorf("%v", x)
+	}
+}
+
+func TestRepeat(t *testing.T) {
+	r := Repeat(7)
+	if l := L(7, 7, 7); !l.Equals(r.Take(3)) {
+		t.Errorf("%v", r.Take(3))
+	}
+	if r.Tail() != r {
+		t.Error()
+	}
+	mul := func(a, b I) I {
+		return a.(int) * b.(int)
+	}
+	if l := L(7, 14, 21); !l.Equals(L(1, 2, 3).ZipWith(r, mul)) {
+		t.Errorf("%v", L(1, 2, 3).ZipWith(r, mul))
+	}
+}
+
+func TestReplicate(t *testing.T) {
+	if l := L("z", "z", "z"); !l.Equals(Replicate(3, "z")) {
+		t.Errorf("%v", Replicate(3, "z"))
+	}
+	if !Replicate(0, 1).Equals(L()) {
+		t.Error()
+	}
+	for _, n := range []uint{0, 1, 10, 1000} {
+		if l := Replicate(n, nil).Length(); l != int(n) {
+			t.Errorf("Replicate(%v).Length() = %v", n, l)
+		}
+	}
+}
+
+func TestIndexOf(t *testing.T) {
+	l := L(1, "a", 2.5, []int{1}, "a")
+	for x, i := range map[I]int{1: 0, "a": 1, 2.5: 2, "b": -1, 2: -1} {
+		if j := l.IndexOf(x); j != i {
+			t.Errorf("IndexOf(%v) = %v", x, j)
+		}
+	}
+	if i := l.IndexOf([]int{1}); i != 3 {
+		t.Errorf("%v", i)
+	}
+	if i := L().IndexOf(1); i != -1 {
+		t.Errorf("%v", i)
+	}
+}
+
+func TestConcurrentForce(t *testing.T) {
+	shared := Updating(0, func(x I) I {
+		return x.(int) + 1
+	}).Map(func(x I) I {
+		return x.(int) * 2
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%4 == 3 {
+				StopMemo()
+				defer StartMemo()
+			}
+			if x, _ := shared.At(500); x != 1000 {
+				t.Errorf("%v", x)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestForcedOnce(t *testing.T) {
+	runs := 0
+	l := MakeThunk(func() *Pair {
+		runs++
+		return &Pair{1, Empty}
+	})
+	for i := 0; i < 3; i++ {
+		if l.Head() != 1 || l.Length() != 1 {
+			t.Error()
+		}
+	}
+	if runs != 1 {
+		t.Errorf("%v", runs)
+	}
+}
+
+func TestNoGlobalMemoState(t *testing.T) {
+	collected := make(chan bool, 100)
+	for i := 0; i < 100; i++ {
+		l := prog.Take(100).Map(func(x I) I {
+			return x.(int) + i
+		})
+		l.Length()
+		runtime.SetFinalizer(l, func(*Thunk) {
+			collected <- true
+		})
+	}
+	for i := 0; i < 20 && len(collected) < 100; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := len(collected); n < 100 {
+		t.Errorf("only %v forced lists collected", n)
+	}
+}
+
+func TestWithMemo(t *testing.T) {
+	counting := func(runs *int) *Thunk {
+		var gen func(int) *Thunk
+		gen = func(n int) *Thunk {
+			return MakeThunk(func() *Pair {
+				*runs++
+				if n == 5 {
+					return nil
+				}
+				return &Pair{n, gen(n + 1)}
+			})
+		}
+		return gen(0)
+	}
+	StopMemo()
+	var plainRuns, memoRuns int
+	plain, memoized := counting(&plainRuns), counting(&memoRuns).WithMemo(true)
+	for i := 0; i < 3; i++ {
+		if !plain.Equals(memoized) {
+			t.Errorf("%v != %v", plain, memoized)
+		}
+	}
+	StartMemo()
+	if plainRuns != 18 || memoRuns != 6 {
+		t.Errorf("%v, %v", plainRuns, memoRuns)
+	}
+	var viewRuns int
+	source := Updating(0, func(x I) I {
+		viewRuns++
+		return x.(int) + 1
+	})
+	view := source.WithMemo(false)
+	for i := 0; i < 3; i++ {
+		if !view.Take(5).Equals(L(0, 1, 2, 3, 4)) {
+			t.Errorf("%v", view.Take(5))
+		}
+	}
+	if viewRuns != 5 {
+		t.Errorf("%v", viewRuns)
+	}
+}
+
+func TestFoldr(t *testing.T) {
+	cons := func(x I, rest func() I) I {
+		return Link(x, rest().(*Thunk))
+	}
+	if l := L(1, 2, 3); !l.Equals(l.Foldr(cons, Empty).(*Thunk)) {
+		t.Errorf("%v", l.Foldr(cons, Empty))
+	}
+	minus := func(x I, rest func() I) I {
+		return x.(int) - rest().(int)
+	}
+	if r := L(1, 2, 3).Foldr(minus, 0); r != 2 {
+		t.Errorf("%v", r)
+	}
+	any10 := func(x I, rest func() I) I {
+		return x.(int) > 10 || rest().(bool)
+	}
+	if !prog.Foldr(any10, false).(bool) || L(1, 2).Foldr(any10, false).(bool) {
+		t.Error()
+	}
+	takeWhileLt4 := func(x I, rest func() I) I {
+		if x.(int) >= 4 {
+			return Empty
+		}
+		return Link(x, rest().(*Thunk))
+	}
+	if l := L(1, 2, 3); !l.Equals(prog.Foldr(takeWhileLt4, Empty).(*Thunk)) {
+		t.Errorf("%v", prog.Foldr(takeWhileLt4, Empty))
+	}
+}
+
+func TestSort(t *testing.T) {
+	big := L(uint64(1)<<63, uint64(3), uint64(1<<40))
+	if l := L(uint64(3), uint64(1<<40), uint64(1)<<63); !l.Equals(big.Sort()) {
+		t.Errorf("%v", big.Sort())
+	}
+	if max, min := big.Max(), big.Min(); max != uint64(1)<<63 || min != uint64(3) {
+		t.Errorf("%v, %v", max, min)
+	}
+	if l := L(1, 2, 3, 4, 5); !l.Equals(L(3, 1, 5, 2, 4).Sort()) {
+		t.Errorf("%v", L(3, 1, 5, 2, 4).Sort())
+	}
+	if l := L(-1.5, 0.0, 2.25); !l.Equals(L(2.25, -1.5, 0.0).Sort()) {
+		t.Errorf("%v", L(2.25, -1.5, 0.0).Sort())
+	}
+	if l := L("apple", "banana", "cherry"); !l.Equals(L("cherry", "apple", "banana").Sort()) {
+		t.Errorf("%v", L("cherry", "apple", "banana").Sort())
+	}
+	if l := L(1, 2, 2, 3); !l.Equals(l.Sort()) {
+		t.Errorf("%v", l.Sort())
+	}
+	if l := prog.Take(10); !l.Equals(l.Reverse().Sort()) {
+		t.Errorf("%v", l.Reverse().Sort())
+	}
+	if l := L(1, 3, 0.5, "a", "b"); !l.Equals(L("b", 0.5, 3, "a", 1).Sort()) {
+		t.Errorf("%v", L("b", 0.5, 3, "a", 1).Sort())
+	}
+	if !L().Sort().Equals(L()) {
+		t.Error()
+	}
+}
+
+func TestSortBy(t *testing.T) {
+	shorter := func(a, b I) bool {
+		return len(a.(string)) < len(b.(string))
+	}
+	l := L("ccc", "a", "bb", "dd", "e", "ff")
+	if s := l.SortBy(shorter); !s.Equals(L("a", "e", "bb", "dd", "ff", "ccc")) {
+		t.Errorf("%v", s)
+	}
+	type person struct {
+		name string
+		age  int
+	}
+	byAge := func(a, b I) bool {
+		return a.(person).age < b.(person).age
+	}
+	people := L(person{"ann", 30}, person{"bob", 20}, person{"cid", 30}, person{"dee", 20})
+	sorted := L(person{"bob", 20}, person{"dee", 20}, person{"ann", 30}, person{"cid", 30})
+	if s := people.SortBy(byAge); !s.Equals(sorted) {
+		t.Errorf("%v", s)
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	data, err := json.Marshal(L(1, 2, 3))
+	if err != nil || string(data) != "[1,2,3]" {
+		t.Errorf("%s, %v", data, err)
+	}
+	var flat []int
+	if err := json.Unmarshal(data, &flat); err != nil || !reflect.DeepEqual(flat, []int{1, 2, 3}) {
+		t.Errorf("%v, %v", flat, err)
+	}
+	data, err = json.Marshal(L(L(1, 2), L(3), L(), "a"))
+	if err != nil || string(data) != `[[1,2],[3],[],"a"]` {
+		t.Errorf("%s, %v", data, err)
+	}
+	var nested []interface{}
+	if err := json.Unmarshal(data, &nested); err != nil || len(nested) != 4 {
+		t.Errorf("%v, %v", nested, err)
+	}
+	if _, err := json.Marshal(Repeat(1)); err == nil {
+		t.Error()
+	}
+	if _, err := json.Marshal(Repeat(1).Take(maxJSONLength)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFromJSON(t *testing.T) {
+	l, err := FromJSON([]byte(`[1, 2, 3]`))
+	if err != nil || !l.Equals(L(1, 2, 3)) {
+		t.Errorf("%v, %v", l, err)
+	}
+	l, err = FromJSON([]byte(`[[1, 2], [3], [], 1.5, "a", true, null]`))
+	if err != nil || !l.Equals(L(L(1, 2), L(3), L(), 1.5, "a", true, nil)) {
+		t.Errorf("%v, %v", l, err)
+	}
+	if l, err := FromJSON([]byte(" [] \n")); err != nil || !l.Equals(L()) {
+		t.Errorf("%v, %v", l, err)
+	}
+	for _, bad := range []string{`[1, 2`, `{"a": 1}`, `3`, ``, `null`, `[1, 2] garbage`, `[1] [2]`} {
+		if l, err := FromJSON([]byte(bad)); err == nil {
+			t.Errorf("FromJSON(%q) = %v", bad, l)
+		}
+	}
+	var v struct {
+		List *Thunk
+	}
+	if err := json.Unmarshal([]byte(`{"List": [[1], 2]}`), &v); err != nil || !v.List.Equals(L(L(1), 2)) {
+		t.Errorf("%v, %v", v.List, err)
+	}
+	data, _ := json.Marshal(v.List)
+	if string(data) != "[[1],2]" {
+		t.Errorf("%s", data)
+	}
+	if err := json.Unmarshal([]byte(`[9]`), L()); err == nil {
+		t.Errorf("Unmarshal into L() didn't fail")
+	}
+	if n := L(1).Length(); n != 1 {
+		t.Errorf("%v", n)
+	}
+	l = L(1, 2, 3)
+	if err := json.Unmarshal([]byte(`[9]`), l.Tail()); err == nil || !l.Equals(L(1, 2, 3)) {
+		t.Errorf("%v, %v", l, err)
+	}
+}
+
+func TestFromReaderLines(t *testing.T) {
+	l := FromReaderLines(strings.NewReader("one\ntwo\r\n\nthree"))
+	if e := L("one", "two", "", "three"); !e.Equals(l) {
+		t.Errorf("%v", l)
+	}
+	if l := FromReaderLines(strings.NewReader("")); !l.Equals(L()) {
+		t.Errorf("%v", l)
+	}
+	boom := errors.New("boom")
+	l = FromReaderLines(io.MultiReader(strings.NewReader("a\nb\n"), iotest.ErrReader(boom)))
+	if s := l.ToSlice(); !reflect.DeepEqual(s, []I{"a", "b", boom}) {
+		t.Errorf("%v", s)
+	}
+	l = FromReaderLines(io.MultiReader(strings.NewReader("a\nb"), iotest.ErrReader(boom)))
+	if s := l.ToSlice(); !reflect.DeepEqual(s, []I{"a", "b", boom}) {
+		t.Errorf("%v", s)
+	}
+	long := FromReaderLines(strings.NewReader(strings.Repeat("x\ny\n", 1000)))
+	if l := long.Filter(func(x I) bool { return x == "y" }).Length(); l != 1000 {
+		t.Errorf("%v", l)
+	}
+}
+
+type shortWriter struct {
+	left int
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.left {
+		p = p[:w.left]
+	}
+	w.left -= len(p)
+	return len(p), nil
+}
+
+func TestWriteTo(t *testing.T) {
+	var buf bytes.Buffer
+	n, err := L(1, "a", 2.5).WriteTo(&buf)
+	if err != nil || n != 8 || buf.String() != "1\na\n2.5\n" {
+		t.Errorf("%v, %v, %q", n, err, buf.String())
+	}
+	buf.Reset()
+	n, err = L(1, 2).WriteFormatted(&buf, "<%03d>")
+	if err != nil || n != 12 || buf.String() != "<001>\n<002>\n" {
+		t.Errorf("%v, %v, %q", n, err, buf.String())
+	}
+	n, err = L(1, 2, 3).WriteTo(&shortWriter{3})
+	if err != io.ErrShortWrite || n != 3 {
+		t.Errorf("%v, %v", n, err)
+	}
+	var _ io.WriterTo = L()
+}
+
+func TestFromChan(t *testing.T) {
+	ch := make(chan I)
+	go func() {
+		for i := 1; i <= 5; i++ {
+			ch <- i
+		}
+		close(ch)
+	}()
+	l := FromChan(ch)
+	if e := L(1, 2); !e.Equals(l.Take(2)) {
+		t.Errorf("%v", l.Take(2))
+	}
+	StopMemo()
+	for i := 0; i < 2; i++ {
+		if e := L(1, 2, 3, 4, 5); !e.Equals(l) {
+			t.Errorf("%v", l)
+		}
+	}
+	StartMemo()
+	buffered := make(chan I, 2)
+	close(buffered)
+	if !FromChan(buffered).Equals(L()) {
+		t.Error()
+	}
+}
+
+func TestPMap(t *testing.T) {
+	square := func(x I) I {
+		return x.(int) * x.(int)
+	}
+	l := prog.Take(1000)
+	for _, workers := range []int{-1, 0, 1, 7} {
+		if p := l.PMap(square, workers); !p.Equals(l.Map(square)) {
+			t.Errorf("PMap with %v workers = %v", workers, p.Take(10))
+		}
+	}
+	slowFirst := func(x I) I {
+		time.Sleep(time.Duration(10-x.(int)) * time.Millisecond)
+		return x
+	}
+	if l := prog.Take(10); !l.Equals(l.PMap(slowFirst, 10)) {
+		t.Errorf("%v", l.PMap(slowFirst, 10))
+	}
+	if !L().PMap(square, 2).Equals(L()) {
+		t.Error()
+	}
+}
+
+func TestReduceContext(t *testing.T) {
+	sum := func(acc, x I) I {
+		return acc.(int) + x.(int)
+	}
+	if r, err := prog.Take(10).ReduceContext(context.Background(), sum, 0); r != 55 || err != nil {
+		t.Errorf("%v, %v", r, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	r, err := prog.ReduceContext(ctx, func(acc, x I) I {
+		calls++
+		if calls == 4 {
+			cancel()
+		}
+		return sum(acc, x)
+	}, 0)
+	if r != 10 || err != context.Canceled || calls != 4 {
+		t.Errorf("%v, %v, %v", r, err, calls)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	naturals := Updating(0, func(x I) I {
+		return x.(int) + 1
+	})
+	if _, err := naturals.ReduceContext(ctx, sum, 0); err != context.DeadlineExceeded {
+		t.Errorf("%v", err)
+	}
+}
+
+func TestMaxByMinBy(t *testing.T) {
+	length := func(x I) float64 {
+		return float64(len(x.(string)))
+	}
+	l := L("bb", "a", "dddd", "cc", "eeee", "f")
+	if x := l.MaxBy(length); x != "dddd" {
+		t.Errorf("%v", x)
+	}
+	if x := l.MinBy(length); x != "a" {
+		t.Errorf("%v", x)
+	}
+	if x := L("x").MaxBy(length); x != "x" {
+		t.Errorf("%v", x)
+	}
+	if L().MaxBy(length) != nil || L().MinBy(length) != nil {
+		t.Error()
+	}
+}
+
+func panics(f func()) (ret bool) {
+	defer func() {
+		ret = recover() != nil
+	}()
+	f()
+	return
+}
+
+func TestSumProduct(t *testing.T) {
+	if s := prog.Take(100).SumInts(); s != 5050 {
+		t.Errorf("%v", s)
+	}
+	if s := L(int8(1), uint(2), int64(3)).SumInts(); s != 6 {
+		t.Errorf("%v", s)
+	}
+	if p := L(1, 2, 3, 4).ProductInts(); p != 24 {
+		t.Errorf("%v", p)
+	}
+	if s := L(0.5, 1, float32(0.25)).SumFloats(); s != 1.75 {
+		t.Errorf("%v", s)
+	}
+	if L().SumInts() != 0 || L().ProductInts() != 1 || L().SumFloats() != 0 {
+		t.Error()
+	}
+	if !panics(func() { L(1, "a").SumInts() }) ||
+		!panics(func() { L(1, 2.5).ProductInts() }) ||
+		!panics(func() { L(1.5, "b").SumFloats() }) {
+		t.Error()
+	}
+}
+
+func TestMeanFloats(t *testing.T) {
+	if m, err := L(1.0, 2.0, 4.5).MeanFloats(); m != 2.5 || err != nil {
+		t.Errorf("%v, %v", m, err)
+	}
+	if m, err := prog.Take(10).MeanFloats(); m != 5.5 || err != nil {
+		t.Errorf("%v, %v", m, err)
+	}
+	if m, err := L(-3).MeanFloats(); m != -3 || err != nil {
+		t.Errorf("%v, %v", m, err)
+	}
+	if _, err := L().MeanFloats(); err == nil {
+		t.Error()
+	}
+	if _, err := L(1, "a").MeanFloats(); err == nil {
+		t.Error()
+	}
+}
+
+func TestEnumerate(t *testing.T) {
+	if l := L(L(0, "a"), L(1, "b")); !l.Equals(L("a", "b").Enumerate()) {
+		t.Errorf("%v", L("a", "b").Enumerate())
+	}
+	if l := L(L(0, 1), L(1, 2), L(2, 3)); !l.Equals(prog.Enumerate().Take(3)) {
+		t.Errorf("%v", prog.Enumerate().Take(3))
+	}
+	if !L().Enumerate().Equals(L()) {
+		t.Error()
+	}
+}
+
+func TestMapIndexed(t *testing.T) {
+	doubleEven := func(i int, x I) I {
+		if i%2 == 0 {
+			return x.(int) * 2
+		}
+		return x
+	}
+	if l := L(20, 11, 24, 13); !l.Equals(L(10, 11, 12, 13).MapIndexed(doubleEven)) {
+		t.Errorf("%v", L(10, 11, 12, 13).MapIndexed(doubleEven))
+	}
+	index := func(i int, x I) I {
+		return i
+	}
+	if l := L(0, 1, 2, 3, 4); !l.Equals(prog.MapIndexed(index).Take(5)) {
+		t.Errorf("%v", prog.MapIndexed(index).Take(5))
+	}
+	if !L().MapIndexed(index).Equals(L()) {
+		t.Error()
+	}
+}
+
+func TestFilterIndexed(t *testing.T) {
+	everyThird := func(i int, x I) bool {
+		return i%3 == 0
+	}
+	if l := L("a", "d", "g"); !l.Equals(L("a", "b", "c", "d", "e", "f", "g").FilterIndexed(everyThird)) {
+		t.Errorf("%v", L("a", "b", "c", "d", "e", "f", "g").FilterIndexed(everyThird))
+	}
+	if l := L(1, 4, 7, 10); !l.Equals(prog.FilterIndexed(everyThird).Take(4)) {
+		t.Errorf("%v", prog.FilterIndexed(everyThird).Take(4))
+	}
+	var seen []int
+	evenValueOddIndex := func(i int, x I) bool {
+		seen = append(seen, i)
+		return x.(int)%2 == 0 && i%2 == 1
+	}
+	if r := L(2, 4, 6, 8, 1, 10).FilterIndexed(evenValueOddIndex); !r.Equals(L(4, 8, 10)) {
+		t.Errorf("%v", r)
+	}
+	if !reflect.DeepEqual(seen, []int{0, 1, 2, 3, 4, 5}) {
+		t.Errorf("%v", seen)
+	}
+}
+
+func TestIntercalate(t *testing.T) {
+	if l := L(1, 2, 0, 3, 4); !l.Equals(L(L(1, 2), L(3, 4)).Intercalate(L(0))) {
+		t.Errorf("%v", L(L(1, 2), L(3, 4)).Intercalate(L(0)))
+	}
+	if l := L(1, 2); !l.Equals(L(L(1, 2)).Intercalate(L(0))) {
+		t.Errorf("%v", L(L(1, 2)).Intercalate(L(0)))
+	}
+	if !L().Intercalate(L(0)).Equals(L()) {
+		t.Error()
+	}
+	nested := L(L(1), L(2, 3), L(4))
+	if l := nested.Flatten(); !l.Equals(nested.Intercalate(L())) {
+		t.Errorf("%v", nested.Intercalate(L()))
+	}
+	if l := L("a", ",", ",", "b"); !l.Equals(L(L("a"), L(), L("b")).Intercalate(L(","))) {
+		t.Errorf("%v", L(L("a"), L(), L("b")).Intercalate(L(",")))
+	}
+	words := prog.Map(func(x I) I {
+		return L(x, x)
+	})
+	if l := L(1, 1, 0, 2, 2, 0); !l.Equals(words.Intercalate(L(0)).Take(6)) {
+		t.Errorf("%v", words.Intercalate(L(0)).Take(6))
+	}
+}
+
+func TestTee(t *testing.T) {
+	StopMemo()
+	defer StartMemo()
+	produced := 0
+	var gen func(int) *Thunk
+	gen = func(n int) *Thunk {
+		return MakeThunk(func() *Pair {
+			if n == 5 {
+				return nil
+			}
+			produced++
+			return &Pair{n, gen(n + 1)}
+		})
+	}
+	a, b := gen(0).Tee()
+	if !a.Take(2).Equals(L(0, 1)) || !b.Equals(L(0, 1, 2, 3, 4)) || !a.Equals(b) {
+		t.Errorf("%v, %v", a, b)
+	}
+	if produced != 5 {
+		t.Errorf("%v", produced)
+	}
+}
+
+func TestShuffle(t *testing.T) {
+	l := L(1, 2, 2, 3, 4, 5, 6, 7, 8, 9)
+	a := l.Shuffle(rand.New(rand.NewSource(42)))
+	if !a.Sort().Equals(l) {
+		t.Errorf("%v is not a permutation of %v", a, l)
+	}
+	b := l.Shuffle(rand.New(rand.NewSource(42)))
+	if !a.Equals(b) {
+		t.Errorf("%v != %v", a, b)
+	}
+	if s := L().Shuffle(rand.New(rand.NewSource(1))); !s.Equals(L()) {
+		t.Errorf("%v", s)
+	}
+	r, replay := rand.New(rand.NewSource(42)), rand.New(rand.NewSource(42))
+	c, d := l.Shuffle(r), l.Shuffle(r)
+	c2, d2 := l.Shuffle(replay), l.Shuffle(replay)
+	// Force d before c; the orders must still match the replayed calls.
+	if !d.Equals(d2) || !c.Equals(c2) || !c.Equals(a) {
+		t.Errorf("%v, %v depend on when they are forced", c, d)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	if d := L(1, 1, 2, 2, 1).Dedup(intEq); !d.Equals(L(1, 2, 1)) {
+		t.Errorf("%v", d)
+	}
+	if d := L(1, 2, 3).Dedup(intEq); !d.Equals(L(1, 2, 3)) {
+		t.Errorf("%v", d)
+	}
+	if d := L(4, 4, 4, 4).Dedup(intEq); !d.Equals(L(4)) {
+		t.Errorf("%v", d)
+	}
+	if d := L().Dedup(intEq); !d.Equals(L()) {
+		t.Errorf("%v", d)
+	}
+	halves := prog.Map(func(x I) I { return x.(int) / 2 })
+	if d := halves.Dedup(intEq).Take(4); !d.Equals(L(0, 1, 2, 3)) {
+		t.Errorf("%v", d)
+	}
+}
+
+func TestStartsWith(t *testing.T) {
+	l := L(1, "a", []int{2})
+	for _, c := range []struct {
+		prefix *Thunk
+		want   bool
+	}{
+		{L(), true},
+		{L(1), true},
+		{L(1, "a", []int{2}), true},
+		{L(1, "b"), false},
+		{L(1, "a", []int{2}, 3), false},
+	} {
+		if got := l.StartsWith(c.prefix); got != c.want {
+			t.Errorf("StartsWith(%v) -> %v", c.prefix, got)
+		}
+	}
+	if !prog.StartsWith(L(1, 2, 3)) || prog.StartsWith(L(1, 3)) {
+		t.Errorf("StartsWith on an infinite list")
+	}
+	if !L().StartsWith(L()) || L().StartsWith(L(1)) {
+		t.Errorf("StartsWith on an empty list")
+	}
+	if !l.EndsWith(L("a", []int{2})) || !l.EndsWith(L()) || !l.EndsWith(l) ||
+		l.EndsWith(L(1, "a")) || L(1).EndsWith(L(0, 1)) {
+		t.Errorf("EndsWith")
+	}
+}
+
+func TestFindBy(t *testing.T) {
+	foldEq := func(a, b I) bool {
+		return strings.EqualFold(a.(string), b.(string))
+	}
+	l := L("Go", "Rust", "go", "Zig")
+	if !l.HasBy("RUST", foldEq) || l.HasBy("C", foldEq) || l.Has("RUST") {
+		t.Errorf("HasBy")
+	}
+	if x, ok := l.FindBy("gO", foldEq); !ok || x != "Go" {
+		t.Errorf("%v, %v", x, ok)
+	}
+	if x, ok := l.FindBy("C", foldEq); ok || x != nil {
+		t.Errorf("%v, %v", x, ok)
+	}
+	if i := l.IndexBy("zig", foldEq); i != 3 {
+		t.Errorf("%v", i)
+	}
+	if i := l.IndexBy("C", foldEq); i != -1 {
+		t.Errorf("%v", i)
+	}
+	if i := L().IndexBy("go", foldEq); i != -1 {
+		t.Errorf("%v", i)
+	}
+}
+
+func TestFoldWhile(t *testing.T) {
+	sumUnder := func(max int) func(acc, x I) (I, bool) {
+		return func(acc, x I) (I, bool) {
+			sum := acc.(int) + x.(int)
+			return sum, sum < max
+		}
+	}
+	acc, rest := L(1, 2, 3, 4, 5).FoldWhile(sumUnder(10), 0)
+	if acc != 6 || !rest.Equals(L(4, 5)) {
+		t.Errorf("%v, %v", acc, rest)
+	}
+	acc, rest = L(1, 2, 3).FoldWhile(sumUnder(100), 0)
+	if acc != 6 || !rest.Equals(L()) {
+		t.Errorf("%v, %v", acc, rest)
+	}
+	acc, rest = L(50, 1).FoldWhile(sumUnder(10), 0)
+	if acc != 0 || !rest.Equals(L(50, 1)) {
+		t.Errorf("%v, %v", acc, rest)
+	}
+	acc, rest = prog.FoldWhile(sumUnder(20), 0)
+	if acc != 15 || !rest.Take(2).Equals(L(6, 7)) {
+		t.Errorf("%v, %v", acc, rest.Take(2))
+	}
+}
+
+func TestCache(t *testing.T) {
+	StopMemo()
+	defer StartMemo()
+	produced := map[int]int{}
+	var gen func(int) *Thunk
+	gen = func(n int) *Thunk {
+		return MakeThunk(func() *Pair {
+			if n == 4 {
+				return nil
+			}
+			produced[n]++
+			return &Pair{n * n, gen(n + 1)}
+		})
+	}
+	c := gen(0).Cache()
+	for i := 0; i < 3; i++ {
+		if !c.Equals(L(0, 1, 4, 9)) {
+			t.Errorf("%v", c)
+		}
+	}
+	if !reflect.DeepEqual(produced, map[int]int{0: 1, 1: 1, 2: 1, 3: 1}) {
+		t.Errorf("%v", produced)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	var seen []int
+	l := L(1, 2, 3).Map(func(x I) I {
+		seen = append(seen, x.(int))
+		return x
+	})
+	l.Drain()
+	if !reflect.DeepEqual(seen, []int{1, 2, 3}) {
+		t.Errorf("%v", seen)
+	}
+	L().Drain()
+	ch := make(chan I, 2)
+	ch <- 1
+	ch <- 2
+	close(ch)
+	FromChan(ch).Drain()
+	if len(ch) != 0 {
+		t.Errorf("%v elements left", len(ch))
+	}
+}
+
+func TestLongList(t *testing.T) {
+	const n = 1000000
+	items := make([]int, n)
+	for i := range items {
+		items[i] = i
+	}
+	l := SliceToList(items)
+	if length := l.Length(); length != n {
+		t.Errorf("Length() -> %v", length)
+	}
+	if x, err := l.At(n - 1); err != nil || x != n-1 {
+		t.Errorf("At(%v) -> %v, %v", n-1, x, err)
+	}
+	if d := l.Drop(n - 2); !d.Equals(L(n-2, n-1)) {
+		t.Errorf("Drop(%v) -> %v", n-2, d)
+	}
+	if d := l.DropWhile(func(x I) bool { return x.(int) < n-1 }); !d.Equals(L(n - 1)) {
+		t.Errorf("DropWhile -> %v", d)
+	}
+	if a := l.Append(L(n)); a.Length() != n+1 || a.Last() != n {
+		t.Errorf("Append -> %v, %v", a.Length(), a.Last())
+	}
+}
+
+func TestListLong(t *testing.T) {
+	const n = 100000
+	items := make([]I, n)
+	for i := range items {
+		items[i] = i
+	}
+	l := List(items...)
+	if length := l.Length(); length != n {
+		t.Errorf("Length() -> %v", length)
+	}
+	if !l.Equals(SliceToList(items)) {
+		t.Errorf("List(items...) differs from SliceToList(items)")
+	}
+}
+
+func TestForEach(t *testing.T) {
+	var seen []I
+	L(1, "a", 3).ForEach(func(x I) bool {
+		seen = append(seen, x)
+		return true
+	})
+	if !reflect.DeepEqual(seen, []I{1, "a", 3}) {
+		t.Errorf("%v", seen)
+	}
+	seen = nil
+	prog.ForEach(func(x I) bool {
+		seen = append(seen, x)
+		return len(seen) < 4
+	})
+	if !reflect.DeepEqual(seen, []I{1, 2, 3, 4}) {
+		t.Errorf("%v", seen)
+	}
+	L().ForEach(func(x I) bool {
+		t.Errorf("called with %v", x)
+		return true
+	})
+}
+
+func TestInsertAt(t *testing.T) {
+	l := L(1, 2, 3)
+	for n, want := range []*Thunk{
+		L(9, 1, 2, 3),
+		L(1, 9, 2, 3),
+		L(1, 2, 9, 3),
+		L(1, 2, 3, 9),
+		L(1, 2, 3, 9),
+	} {
+		if got := l.InsertAt(uint(n), 9); !got.Equals(want) {
+			t.Errorf("InsertAt(%v, 9) -> %v", n, got)
+		}
+	}
+	if got := L().InsertAt(5, 9); !got.Equals(L(9)) {
+		t.Errorf("%v", got)
+	}
+	if got := prog.InsertAt(2, 0).Take(5); !got.Equals(L(1, 2, 0, 3, 4)) {
+		t.Errorf("%v", got)
+	}
+	if got := l.InsertAt(1, 9).Drop(2); force(got) != force(force(l).Tail) {
+		t.Errorf("the rest of the list isn't shared")
+	}
+}
+
+func TestRemoveAt(t *testing.T) {
+	l := L(1, 2, 3)
+	for n, want := range []*Thunk{
+		L(2, 3),
+		L(1, 3),
+		L(1, 2),
+		L(1, 2, 3),
+		L(1, 2, 3),
+	} {
+		if got := l.RemoveAt(uint(n)); !got.Equals(want) {
+			t.Errorf("RemoveAt(%v) -> %v", n, got)
+		}
+	}
+	if got := L().RemoveAt(0); !got.Equals(L()) {
+		t.Errorf("%v", got)
+	}
+	if got := prog.RemoveAt(1).Take(3); !got.Equals(L(1, 3, 4)) {
+		t.Errorf("%v", got)
+	}
+}
+
+func TestUpdateAt(t *testing.T) {
+	l := L(1, 2, 3)
+	for n, want := range []*Thunk{
+		L(9, 2, 3),
+		L(1, 9, 3),
+		L(1, 2, 9),
+		L(1, 2, 3),
+		L(1, 2, 3),
+	} {
+		if got := l.UpdateAt(uint(n), 9); !got.Equals(want) {
+			t.Errorf("UpdateAt(%v, 9) -> %v", n, got)
+		}
+	}
+	if got := L().UpdateAt(0, 9); !got.Equals(L()) {
+		t.Errorf("%v", got)
+	}
+	if got := prog.UpdateAt(0, 0).Take(3); !got.Equals(L(0, 2, 3)) {
+		t.Errorf("%v", got)
+	}
+	if got := l.UpdateAt(0, 9); force(got).Tail != force(l).Tail {
+		t.Errorf("the rest of the list isn't shared")
+	}
+}
+
+func TestBecome(t *testing.T) {
+	l := L(1, 2, 3)
+	for _, target := range []*Thunk{Empty, l, l.Tail(), l.Map(func(x I) I { return x })} {
+		if err := target.become(L(9)); err == nil {
+			t.Errorf("become(L(9)) on %v didn't fail", target)
+		}
+	}
+	if !l.Equals(L(1, 2, 3)) || L(1).Length() != 1 {
+		t.Errorf("%v", l)
+	}
+	fresh := new(Thunk)
+	if err := fresh.become(L(9)); err != nil || !fresh.Equals(L(9)) {
+		t.Errorf("%v, %v", fresh, err)
+	}
+}
+
+func usualFibo(n int) int {
+	if n <= 1 {
+		return 1
+	}
+	return usualFibo(n-1) + usualFibo(n-2)
+}
+
+func BenchmarkIterSlice(b *testing.B) {
+	b.StopTimer()
+	s := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10,
+		11, 12, 13, 14, 15, 16, 17, 18, 19, 20}
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		for _ = range s {
+		}
+	}
+}
+
+func BenchmarkIterList(b *testing.B) {
+	b.StopTimer()
+	l := L(1, 2, 3, 4, 5, 6, 7, 8, 9, 10,
+		11, 12, 13, 14, 15, 16, 17, 18, 19, 20)
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		for _ = range l.Iter() {
+		}
+	}
+}
+
+func BenchmarkIterListNoMemo(b *testing.B) {
+	b.StopTimer()
+	StopMemo()
+	l := L(1, 2, 3, 4, 5, 6, 7, 8, 9, 10,
+		11, 12, 13, 14, 15, 16, 17, 18, 19, 20)
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		for _ = range l.Iter() {
+		}
+	}
+	StartMemo()
+}
+
+func BenchmarkMapLoop(b *testing.B) {
+	b.StopTimer()
+	s := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10,
+		11, 12, 13, 14, 15, 16, 17, 18, 19, 20}
+	double := func(n int) int {
+		return n * 2
+	}
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		for k, v := range s {
+			s[k] = double(v)
+		}
+		_ = s[0]
+	}
+}
+
+func BenchmarkMapList(b *testing.B) {
+	b.StopTimer()
+	l := L(1, 2, 3, 4, 5, 6, 7, 8, 9, 10,
+		11, 12, 13, 14, 15, 16, 17, 18, 19, 20)
+	double := func(n I) I {
+		return n.(int) * 2
+	}
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = l.Map(double).At(0)
+	}
+}
+
+func BenchmarkMapListNoMemo(b *testing.B) {
+	b.StopTimer()
+	StopMemo()
+	l := L(1, 2, 3, 4, 5, 6, 7, 8, 9, 10,
+		11, 12, 13, 14, 15, 16, 17, 18, 19, 20)
+	double := func(n I) I {
+		return n.(int) * 2
+	}
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = l.Map(double).At(0)
+	}
+	StartMemo()
+}
+
+func BenchmarkAppendSlices(b *testing.B) {
+	b.StopTimer()
+	s := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10,
+		11, 12, 13, 14, 15, 16, 17, 18, 19, 20}
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		_ = append(s, s...)
+	}
+}
+
+func BenchmarkAppendLists(b *testing.B) {
+	l := L(1, 2, 3, 4, 5, 6, 7, 8, 9, 10,
+		11, 12, 13, 14, 15, 16, 17, 18, 19, 20)
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		_ = l.Append(l)
+	}
+}
+
+func BenchmarkAppendLsNoMemo(b *testing.B) {
+	b.StopTimer()
+	StopMemo()
+	l := L(1, 2, 3, 4, 5, 6, 7, 8, 9, 10,
+		11, 12, 13, 14, 15, 16, 17, 18, 19, 20)
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		_ = l.Append(l)
+	}
+	StartMemo()
+}
+
+func BenchmarkUsualFibo(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		usualFibo(30)
+	}
+}
+
+func BenchmarkFiboStream(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_, _ = fibo.At(30)
+	}
+}
+
+func BenchmarkFiboStrNoMemo(b *testing.B) {
+	b.StopTimer()
+	StopMemo()
+	fibo = Link(1, DelayedLink(1, func() *Thunk {
+		return MapN(func(xs ...I) I {
+			ret := 0
+			for _, v := range xs {
+				ret += v.(int)
+			}
+			return ret
+		}, fibo, fibo.Tail())
+	}))
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = fibo.At(30)
+	}
+	StartMemo()
+}
+
+func mergeBenchLists() []*Thunk {
+	lists := make([]*Thunk, 16)
+	for k := range lists {
+		lists[k] = Updating(k, func(x I) I {
+			return x.(int) + len(lists)
+		}).Take(64)
+	}
+	return lists
+}
+
+func BenchmarkMergeN(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		MergeN(intLess, mergeBenchLists()...).Length()
+	}
+}
+
+func BenchmarkMergeTwoWay(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		lists := mergeBenchLists()
+		m := lists[0]
+		for _, l := range lists[1:] {
+			m = MergeN(intLess, m, l)
+		}
+		m.Length()
+	}
+}
+
+func BenchmarkReduceConcat(b *testing.B) {
+	words := Updating(1, func(x I) I {
+		return x.(int) + 1
+	}).Take(2000).Map(func(x I) I {
+		return fmt.Sprint(x, ",")
+	})
+	words.Length()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		words.Reduce(concatStrings, "")
+	}
+}
+
+func BenchmarkParFoldTreeConcat(b *testing.B) {
+	words := Updating(1, func(x I) I {
+		return x.(int) + 1
+	}).Take(2000).Map(func(x I) I {
+		return fmt.Sprint(x, ",")
+	})
+	words.Length()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		words.ParFoldTree(concatStrings, "", 0)
+	}
+}
+
+func benchmarkReverseAt(b *testing.B) {
+	l := Updating(1, func(x I) I {
+		return x.(int) + 1
+	}).Take(1000).Reverse()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = l.At(uint(i % 10))
+	}
+}
+
+func BenchmarkReverseAt(b *testing.B) {
+	benchmarkReverseAt(b)
+}
+
+func BenchmarkReverseAtNoMemo(b *testing.B) {
+	StopMemo()
+	benchmarkReverseAt(b)
+	StartMemo()
+}
+
+func BenchmarkAppendTraverseNoMemo(b *testing.B) {
+	StopMemo()
+	defer StartMemo()
+	first := make([]int, 5000)
+	second := make([]int, 2000)
+	l := SliceToList(first).Append(SliceToList(second))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Length()
+	}
+}
+
+func concatBenchLists() []*Thunk {
+	lists := make([]*Thunk, 1000)
+	for i := range lists {
+		lists[i] = L(i, i, i)
+	}
+	return lists
+}
+
+func BenchmarkConcatAll(b *testing.B) {
+	lists := SliceToList(concatBenchLists())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ConcatAll(lists).Length()
+	}
+}
+
+func BenchmarkConcatFoldAppend(b *testing.B) {
+	lists := concatBenchLists()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		all := Empty
+		for _, l := range lists {
+			all = all.Append(l)
+		}
+		all.Length()
+	}
+}
+
+func recursiveList(items ...I) *Thunk {
+	if len(items) >= 1 {
+		return Link(items[0], recursiveList(items[1:]...))
+	}
+	return Empty
+}
+
+func listBenchItems() []I {
+	items := make([]I, 10000)
+	for i := range items {
+		items[i] = i
+	}
+	return items
+}
+
+func BenchmarkList(b *testing.B) {
+	items := listBenchItems()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		List(items...)
+	}
+}
+
+func BenchmarkListRecursive(b *testing.B) {
+	items := listBenchItems()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		recursiveList(items...)
 	}
-	StartMemo()
 }
@@ -0,0 +1,3 @@
+module github.com/tcard/functional
+
+go 1.20
@@ -0,0 +1,126 @@
+// Package typed is a statically typed layer over the lazy lists of package
+// functional. A List[T] wraps a functional Thunk whose elements are all of
+// type T, so that they can be used without type assertions.
+//
+//	naturals := typed.Iterate(func(n int) int { return n + 1 }, 0)
+//	squares := typed.Map(naturals, func(n int) int { return n * n })
+//	squares.Take(4).ToSlice() // []int{0, 1, 4, 9}
+package typed
+
+import (
+	FP "github.com/tcard/functional"
+)
+
+// A List of elements of type T. The zero List is empty.
+type List[T any] struct {
+	thunk *FP.Thunk
+}
+
+// Wraps a Thunk as a List. The elements of the Thunk must be of type T;
+// otherwise the List functions panic when they reach them.
+func FromThunk[T any](thunk *FP.Thunk) List[T] {
+	return List[T]{thunk}
+}
+
+// Returns the underlying Thunk, to use the untyped functions on it.
+func (l List[T]) ToThunk() *FP.Thunk {
+	if l.thunk == nil {
+		return FP.Empty
+	}
+	return l.thunk
+}
+
+// Makes a List from its elements.
+func Of[T any](items ...T) List[T] {
+	return FromSlice(items)
+}
+
+// Makes a List from a slice.
+func FromSlice[T any](items []T) List[T] {
+	ret := FP.Empty
+	for i := len(items) - 1; i >= 0; i-- {
+		ret = FP.Link(items[i], ret)
+	}
+	return List[T]{ret}
+}
+
+// Makes a slice from a finite List.
+func (l List[T]) ToSlice() []T {
+	items := l.ToThunk().ToSlice()
+	ret := make([]T, len(items))
+	for i, x := range items {
+		ret[i] = x.(T)
+	}
+	return ret
+}
+
+// Makes an infinite List of initial, f(initial), f(f(initial)) and so on.
+func Iterate[T any](f func(T) T, initial T) List[T] {
+	return List[T]{FP.Iterate(func(x FP.I) FP.I {
+		return f(x.(T))
+	}, initial)}
+}
+
+// Retrieves the first element of a List. ok is false if it is empty.
+func (l List[T]) Head() (x T, ok bool) {
+	head, ok := l.ToThunk().HeadSafe()
+	if !ok {
+		return x, false
+	}
+	return head.(T), true
+}
+
+// Returns a List without its first element, or an empty List if it is
+// already empty.
+func (l List[T]) Tail() List[T] {
+	return List[T]{l.ToThunk().Drop(1)}
+}
+
+// Counts the elements of a finite List.
+func (l List[T]) Length() int {
+	return l.ToThunk().Length()
+}
+
+// Takes the first n elements of a List.
+func (l List[T]) Take(n uint) List[T] {
+	return List[T]{l.ToThunk().Take(n)}
+}
+
+// Drops the first n elements of a List and returns the rest.
+func (l List[T]) Drop(n uint) List[T] {
+	return List[T]{l.ToThunk().Drop(n)}
+}
+
+// Lists the elements of a List that pass a testing function.
+func (l List[T]) Filter(f func(T) bool) List[T] {
+	return List[T]{l.ToThunk().Filter(func(x FP.I) bool {
+		return f(x.(T))
+	})}
+}
+
+// Lists the first elements of a List that pass a testing function.
+func (l List[T]) TakeWhile(f func(T) bool) List[T] {
+	return List[T]{l.ToThunk().TakeWhile(func(x FP.I) bool {
+		return f(x.(T))
+	})}
+}
+
+// Makes a single List by appending one to another.
+func (l List[T]) Append(other List[T]) List[T] {
+	return List[T]{l.ToThunk().Append(other.ToThunk())}
+}
+
+// Applies a function to each element of a List.
+func Map[T, U any](l List[T], f func(T) U) List[U] {
+	return List[U]{l.ToThunk().Map(func(x FP.I) FP.I {
+		return f(x.(T))
+	})}
+}
+
+// Applies a function to each element of a finite List, returning the
+// accumulated value, starting with initial.
+func Reduce[T, A any](l List[T], f func(A, T) A, initial A) A {
+	return l.ToThunk().Reduce(func(acc, x FP.I) FP.I {
+		return f(acc.(A), x.(T))
+	}, initial).(A)
+}
@@ -0,0 +1,81 @@
+package typed
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	FP "github.com/tcard/functional"
+)
+
+func TestMap(t *testing.T) {
+	ints := Of(1, 2, 3)
+	strs := Map(ints, func(n int) string {
+		return strconv.Itoa(n * 10)
+	})
+	if s := strs.ToSlice(); !reflect.DeepEqual(s, []string{"10", "20", "30"}) {
+		t.Errorf("%v", s)
+	}
+	var s string
+	s, _ = strs.Head()
+	if s != "10" {
+		t.Errorf("%v", s)
+	}
+}
+
+func TestFilterReduce(t *testing.T) {
+	naturals := Iterate(func(n int) int { return n + 1 }, 0)
+	evens := naturals.Filter(func(n int) bool {
+		return n%2 == 0
+	})
+	if s := evens.Take(4).ToSlice(); !reflect.DeepEqual(s, []int{0, 2, 4, 6}) {
+		t.Errorf("%v", s)
+	}
+	sum := Reduce(evens.Drop(1).Take(3), func(acc float64, n int) float64 {
+		return acc + float64(n)/2
+	}, 0.5)
+	if sum != 6.5 {
+		t.Errorf("%v", sum)
+	}
+	small := naturals.TakeWhile(func(n int) bool { return n < 3 })
+	if n, ok := naturals.Drop(5).Head(); !ok || n != 5 {
+		t.Errorf("%v, %v", n, ok)
+	}
+	if s := small.Append(Of(9)).ToSlice(); !reflect.DeepEqual(s, []int{0, 1, 2, 9}) {
+		t.Errorf("%v", s)
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	var l List[int]
+	if _, ok := l.Head(); ok || l.Length() != 0 || l.Tail().Length() != 0 {
+		t.Error()
+	}
+	if s := l.ToSlice(); len(s) != 0 {
+		t.Errorf("%v", s)
+	}
+}
+
+func TestHeadForcesOnce(t *testing.T) {
+	FP.StopMemo()
+	defer FP.StartMemo()
+	runs := 0
+	l := Map(Of(1, 2, 3), func(n int) int {
+		runs++
+		return n
+	})
+	if n, ok := l.Head(); !ok || n != 1 || runs != 1 {
+		t.Errorf("%v, %v, %v", n, ok, runs)
+	}
+}
+
+func TestThunkConversion(t *testing.T) {
+	l := FromThunk[int](FP.L(1, 2, 3))
+	doubled := Map(l, func(n int) int { return n * 2 })
+	if !doubled.ToThunk().Equals(FP.L(2, 4, 6)) {
+		t.Errorf("%v", doubled.ToThunk())
+	}
+	if n := FromSlice([]string{"a", "b"}).Length(); n != 2 {
+		t.Errorf("%v", n)
+	}
+}